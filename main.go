@@ -22,14 +22,156 @@ import (
 	"io/ioutil"
 	"os"
 
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/config"
 	discovery "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
 	git "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/git"
-
+	gitea "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitea"
 	github "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/github"
+	gitlab "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitlab"
+	helm "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/helm"
+	index "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/index"
+	local "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/local"
+	registry "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/registry"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
+// outputFlags are the flags of every command setting how the versions are written
+var outputFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:   "output-file",
+		EnvVar: "OUTPUT_FILE",
+		Value:  "/data/output",
+		Usage:  "File to output the resulting json from",
+	},
+	&cli.StringFlag{
+		Name:   "on-conflict",
+		EnvVar: "ON_CONFLICT",
+		Value:  string(discovery.ConflictFirstWins),
+		Usage:  "Policy for versions with the same name: first, last, error or merge",
+	},
+	&cli.StringFlag{
+		Name:   "name-policy",
+		EnvVar: "NAME_POLICY",
+		Value:  string(discovery.NamesValidate),
+		Usage:  "Policy for versions whose name isn't a valid Kubernetes name: validate or sanitize",
+	},
+}
+
+// filterFlags are the flags filtering the versions of a single source, set per source by the multi command
+var filterFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:   "version-constraint",
+		EnvVar: "VERSION_CONSTRAINT",
+		Value:  "",
+		Usage:  "Semver constraint versions have to satisfy (e.g. '>=v0.2.0 <v1.0.0')",
+	},
+	&cli.IntFlag{
+		Name:   "keep-latest",
+		EnvVar: "KEEP_LATEST",
+		Value:  0,
+		Usage:  "Keep only the latest N versions of each minor release (0 means all)",
+	},
+	&cli.StringFlag{
+		Name:   "exclude-versions",
+		EnvVar: "EXCLUDE_VERSIONS",
+		Value:  "",
+		Usage:  "Regular expression of versions to exclude",
+	},
+	&cli.StringFlag{
+		Name:   "non-semver",
+		EnvVar: "NON_SEMVER",
+		Value:  string(discovery.NonSemverKeep),
+		Usage:  "Policy for versions which are not valid semver: keep, skip or fail",
+	},
+}
+
+var commonFlags = concatFlags(outputFlags, filterFlags)
+
+// concatFlags returns a new list of the flags, with no spare capacity so appending to it copies it
+func concatFlags(lists ...[]cli.Flag) []cli.Flag {
+	n := 0
+	for _, l := range lists {
+		n += len(l)
+	}
+	res := make([]cli.Flag, 0, n)
+	for _, l := range lists {
+		res = append(res, l...)
+	}
+	return res
+}
+
+var registryFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:   "registry-username",
+		EnvVar: "REGISTRY_USERNAME",
+		Value:  "",
+		Usage:  "Username used to authenticate against the registry",
+	},
+	&cli.StringFlag{
+		Name:   "registry-password",
+		EnvVar: "REGISTRY_PASSWORD",
+		Value:  "",
+		Usage:  "Password used to authenticate against the registry",
+	},
+	&cli.StringFlag{
+		Name:   "registry-token",
+		EnvVar: "REGISTRY_TOKEN",
+		Value:  "",
+		Usage:  "Bearer token used to authenticate against the registry",
+	},
+	&cli.BoolFlag{
+		Name:   "plain-http",
+		EnvVar: "PLAIN_HTTP",
+		Usage:  "Use plain HTTP instead of HTTPS to talk to the registry",
+	},
+	&cli.BoolFlag{
+		Name:   "pin-digest",
+		EnvVar: "PIN_DIGEST",
+		Usage:  "Pin the upgrade images to the digest of their tag",
+	},
+	&cli.StringFlag{
+		Name:   "missing-images",
+		EnvVar: "MISSING_IMAGES",
+		Value:  string(release.MissingImageDrop),
+		Usage:  "Policy for versions whose image doesn't exist when pinning digests: drop or fail",
+	},
+}
+
+// withFilter wraps the discoverer with the version filter configured from the command flags
+func withFilter(c *cli.Context, d discovery.Discoverer) (discovery.Discoverer, error) {
+	return discovery.NewFilter(d,
+		discovery.WithConstraint(c.String("version-constraint")),
+		discovery.WithKeepLatest(c.Int("keep-latest")),
+		discovery.WithExclude(c.String("exclude-versions")),
+		discovery.WithNonSemverPolicy(discovery.NonSemverPolicy(c.String("non-semver"))),
+	)
+}
+
+// writeVersions collects the versions of the discoverers and writes them to the output file
+func writeVersions(outFile string, policy discovery.ConflictPolicy, names discovery.NamePolicy, d ...discovery.Discoverer) error {
+	col, err := discovery.NewCollector(
+		discovery.WithConflictPolicy(policy),
+		discovery.WithNamePolicy(names),
+	)
+	if err != nil {
+		return err
+	}
+
+	b, err := col.Versions(d...)
+	if err != nil {
+		return err
+	}
+
+	if outFile == "" {
+		fmt.Print(string(b))
+		return nil
+	}
+
+	return ioutil.WriteFile(outFile, b, os.ModePerm)
+}
+
 func main() {
 	app := &cli.App{
 		Name:        "upgradechannel-discovery",
@@ -41,13 +183,7 @@ func main() {
 		Commands: []cli.Command{
 			{
 				Name: "git",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:   "output-file",
-						EnvVar: "OUTPUT_FILE",
-						Value:  "/data/output",
-						Usage:  "File to output the resulting json from",
-					},
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:   "branch",
 						EnvVar: "BRANCH",
@@ -65,36 +201,163 @@ func main() {
 						Usage:  "Repository subpath",
 						EnvVar: "SUBPATH",
 					},
-				},
+					&cli.StringFlag{
+						Name:   "git-username",
+						EnvVar: "GIT_USERNAME",
+						Value:  "",
+						Usage:  "Username used to clone HTTP(S) repositories",
+					},
+					&cli.StringFlag{
+						Name:   "git-password",
+						EnvVar: "GIT_PASSWORD",
+						Value:  "",
+						Usage:  "Password used to clone HTTP(S) repositories",
+					},
+					&cli.StringFlag{
+						Name:   "git-token",
+						EnvVar: "GIT_TOKEN",
+						Value:  "",
+						Usage:  "Access token used to clone HTTP(S) repositories",
+					},
+					&cli.StringFlag{
+						Name:   "ssh-user",
+						EnvVar: "SSH_USER",
+						Value:  "git",
+						Usage:  "User used to clone SSH repositories",
+					},
+					&cli.StringFlag{
+						Name:   "ssh-key",
+						EnvVar: "SSH_KEY",
+						Value:  "",
+						Usage:  "PEM encoded private key used to clone SSH repositories",
+					},
+					&cli.StringFlag{
+						Name:   "ssh-key-file",
+						EnvVar: "SSH_KEY_FILE",
+						Value:  "",
+						Usage:  "Private key file used to clone SSH repositories",
+					},
+					&cli.StringFlag{
+						Name:   "ssh-key-passphrase",
+						EnvVar: "SSH_KEY_PASSPHRASE",
+						Value:  "",
+						Usage:  "Passphrase of the SSH private key",
+					},
+					&cli.StringFlag{
+						Name:   "known-hosts-file",
+						EnvVar: "KNOWN_HOSTS_FILE",
+						Value:  "",
+						Usage:  "known_hosts file used to verify the SSH host keys",
+					},
+					&cli.BoolFlag{
+						Name:   "insecure-ignore-host-key",
+						EnvVar: "INSECURE_IGNORE_HOST_KEY",
+						Usage:  "Skip the verification of the SSH host keys",
+					},
+					&cli.StringSliceFlag{
+						Name:   "include-files",
+						EnvVar: "INCLUDE_FILES",
+						Usage:  "Glob patterns of the version files to parse (default: *.json, *.yaml, *.yml)",
+					},
+					&cli.StringSliceFlag{
+						Name:   "exclude-files",
+						EnvVar: "EXCLUDE_FILES",
+						Usage:  "Glob patterns of the files to ignore",
+					},
+					&cli.BoolFlag{
+						Name:   "strict",
+						EnvVar: "STRICT",
+						Usage:  "Fail if any version file is invalid instead of skipping it",
+					},
+					&cli.BoolFlag{
+						Name:   "tags",
+						EnvVar: "TAGS",
+						Usage:  "Create the versions from the repository tags instead of its version files",
+					},
+					&cli.StringFlag{
+						Name:   "tag-pattern",
+						EnvVar: "TAG_PATTERN",
+						Value:  "",
+						Usage:  "Regular expression tags have to match",
+					},
+					&cli.StringFlag{
+						Name:   "tag-constraint",
+						EnvVar: "TAG_CONSTRAINT",
+						Value:  "",
+						Usage:  "Semver constraint tags have to satisfy, non-semver tags are skipped if set",
+					},
+					&cli.StringFlag{
+						Name:   "image-prefix",
+						Value:  "",
+						EnvVar: "IMAGE_PREFIX",
+						Usage:  "Image prefix to use when returning json data",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-prefix",
+						EnvVar: "VERSION_NAME_PREFIX",
+						Value:  "",
+						Usage:  "Version name prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-suffix",
+						EnvVar: "VERSION_NAME_SUFFIX",
+						Value:  "",
+						Usage:  "Version name suffix",
+					},
+					&cli.StringFlag{
+						Name:   "version-prefix",
+						EnvVar: "VERSION_PREFIX",
+						Value:  "",
+						Usage:  "Version prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-suffix",
+						EnvVar: "VERSION_SUFFIX",
+						Value:  "",
+						Usage:  "Version suffix",
+					},
+				}, commonFlags...),
 				Action: func(c *cli.Context) error {
-					outFile := c.String("output-file")
-
 					rf, err := git.NewReleaseFinder(
 						git.WithRepository(c.String("repository")),
 						git.WithSubpath(c.String("subpath")),
 						git.WithBranch(c.String("branch")),
+						git.WithBasicAuth(c.String("git-username"), c.String("git-password")),
+						git.WithToken(c.String("git-token")),
+						git.WithSSHUser(c.String("ssh-user")),
+						git.WithSSHKey(c.String("ssh-key")),
+						git.WithSSHKeyFile(c.String("ssh-key-file")),
+						git.WithSSHKeyPassphrase(c.String("ssh-key-passphrase")),
+						git.WithKnownHostsFile(c.String("known-hosts-file")),
+						git.WithInsecureIgnoreHostKey(c.Bool("insecure-ignore-host-key")),
+						git.WithStrict(c.Bool("strict")),
+						git.WithInclude(c.StringSlice("include-files")...),
+						git.WithExclude(c.StringSlice("exclude-files")...),
+						git.WithTags(c.Bool("tags")),
+						git.WithTagPattern(c.String("tag-pattern")),
+						git.WithTagConstraint(c.String("tag-constraint")),
+						git.WithBaseImage(c.String("image-prefix")),
+						git.WithVersionPrefix(c.String("version-prefix")),
+						git.WithVersionSuffix(c.String("version-suffix")),
+						git.WithVersionNamePrefix(c.String("version-name-prefix")),
+						git.WithVersionNameSuffix(c.String("version-name-suffix")),
 					)
 
 					if err != nil {
 						return err
 					}
 
-					b, err := discovery.Versions(rf)
+					d, err := withFilter(c, rf)
 					if err != nil {
 						return err
 					}
 
-					if outFile == "" {
-						fmt.Print(string(b))
-						return nil
-					}
-
-					return ioutil.WriteFile(outFile, b, os.ModePerm)
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
 				},
 			},
 			{
 				Name: "github",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:   "image-prefix",
 						Value:  "",
@@ -108,10 +371,100 @@ func main() {
 						Usage:  "Github token used to identify against github for fetching releases",
 					},
 					&cli.StringFlag{
-						Name:   "output-file",
-						EnvVar: "OUTPUT_FILE",
-						Value:  "/data/output",
-						Usage:  "File to output the resulting json from",
+						Name:   "github-token-file",
+						EnvVar: "GITHUB_TOKEN_FILE",
+						Value:  "",
+						Usage:  "File to read the Github token from, e.g. mounted from a secret",
+					},
+					&cli.Int64Flag{
+						Name:   "github-app-id",
+						EnvVar: "GITHUB_APP_ID",
+						Usage:  "ID of the Github App to authenticate as",
+					},
+					&cli.Int64Flag{
+						Name:   "github-app-installation-id",
+						EnvVar: "GITHUB_APP_INSTALLATION_ID",
+						Usage:  "ID of the Github App installation to request tokens for",
+					},
+					&cli.StringFlag{
+						Name:   "github-app-private-key-file",
+						EnvVar: "GITHUB_APP_PRIVATE_KEY_FILE",
+						Value:  "",
+						Usage:  "File with the PEM private key of the Github App",
+					},
+					&cli.StringFlag{
+						Name:   "github-api-url",
+						EnvVar: "GITHUB_API_URL",
+						Value:  "",
+						Usage:  "API URL of a Github Enterprise server, e.g. https://github.example.com/api/v3/",
+					},
+					&cli.StringFlag{
+						Name:   "github-upload-url",
+						EnvVar: "GITHUB_UPLOAD_URL",
+						Value:  "",
+						Usage:  "Upload URL of a Github Enterprise server, defaults to the API URL",
+					},
+					&cli.StringFlag{
+						Name:   "github-ca-bundle",
+						EnvVar: "GITHUB_CA_BUNDLE",
+						Value:  "",
+						Usage:  "File with PEM certificates to trust when talking to the Github API",
+					},
+					&cli.StringFlag{
+						Name:   "github-proxy",
+						EnvVar: "GITHUB_PROXY",
+						Value:  "",
+						Usage:  "Proxy URL used to talk to the Github API, instead of the one set in the environment",
+					},
+					&cli.DurationFlag{
+						Name:   "rate-limit-timeout",
+						EnvVar: "RATE_LIMIT_TIMEOUT",
+						Value:  github.DefaultRateLimitTimeout,
+						Usage:  "How long to wait for the Github API rate limits to reset, 0 to fail right away",
+					},
+					&cli.StringFlag{
+						Name:   "cache-dir",
+						EnvVar: "CACHE_DIR",
+						Value:  "",
+						Usage:  "Directory caching the Github API responses, to send conditional requests",
+					},
+					&cli.DurationFlag{
+						Name:   "cache-max-staleness",
+						EnvVar: "CACHE_MAX_STALENESS",
+						Value:  github.DefaultCacheMaxStaleness,
+						Usage:  "How old cached responses can be to be used when the Github API is unreachable, 0 to never use them",
+					},
+					&cli.StringFlag{
+						Name:   "metadata-profile",
+						EnvVar: "METADATA_PROFILE",
+						Value:  string(release.MetadataFull),
+						Usage:  "Release data added to the versions metadata: full, curated or none",
+					},
+					&cli.StringSliceFlag{
+						Name:   "metadata-fields",
+						EnvVar: "METADATA_FIELDS",
+						Usage:  "Release fields added to the versions metadata, as key=.path selectors, e.g. author=.author.login",
+					},
+					&cli.StringFlag{
+						Name:   "asset-pattern",
+						EnvVar: "ASSET_PATTERN",
+						Usage:  "Regular expression of release assets to build a version from each, instead of a container version per release",
+					},
+					&cli.StringFlag{
+						Name:   "asset-type",
+						EnvVar: "ASSET_TYPE",
+						Value:  release.ContainerType,
+						Usage:  "Type of the versions built from release assets, e.g. iso",
+					},
+					&cli.BoolFlag{
+						Name:   "body-manifest",
+						EnvVar: "BODY_MANIFEST",
+						Usage:  "Merge the first fenced YAML or JSON block of the release notes into the versions spec",
+					},
+					&cli.StringFlag{
+						Name:   "manifest-asset",
+						EnvVar: "MANIFEST_ASSET",
+						Usage:  "Name of a release asset merged into the versions spec, e.g. managedosversion.yaml",
 					},
 					&cli.StringFlag{
 						Name:   "version-name-prefix",
@@ -137,6 +490,24 @@ func main() {
 						Value:  "",
 						Usage:  "Version suffix",
 					},
+					&cli.StringFlag{
+						Name:   "version-template",
+						EnvVar: "VERSION_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the versions, replacing the version prefix and suffix",
+					},
+					&cli.StringFlag{
+						Name:   "name-template",
+						EnvVar: "NAME_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the version names, replacing the version name prefix and suffix",
+					},
+					&cli.StringFlag{
+						Name:   "image-template",
+						EnvVar: "IMAGE_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the upgrade images, replacing the image prefix",
+					},
 					&cli.StringFlag{
 						Name:   "repository",
 						EnvVar: "REPOSITORY",
@@ -148,37 +519,664 @@ func main() {
 						Usage:  "Enable pre-releases in the releases scan",
 						EnvVar: "PRE_RELEASES",
 					},
-				},
+					&cli.IntFlag{
+						Name:   "max-releases",
+						EnvVar: "MAX_RELEASES",
+						Value:  0,
+						Usage:  "Maximum number of releases to retrieve from github (0 means all)",
+					},
+					&cli.BoolFlag{
+						Name:   "drafts",
+						EnvVar: "DRAFTS",
+						Usage:  "Include draft releases, only visible with a token with push access",
+					},
+					&cli.BoolFlag{
+						Name:   "latest-only",
+						EnvVar: "LATEST_ONLY",
+						Usage:  "Only include the release marked as latest",
+					},
+					&cli.StringFlag{
+						Name:   "published-after",
+						EnvVar: "PUBLISHED_AFTER",
+						Usage:  "Only include releases published after this RFC 3339 time or YYYY-MM-DD date",
+					},
+					&cli.StringFlag{
+						Name:   "published-before",
+						EnvVar: "PUBLISHED_BEFORE",
+						Usage:  "Only include releases published before this RFC 3339 time or YYYY-MM-DD date",
+					},
+					&cli.StringFlag{
+						Name:   "tag-pattern",
+						EnvVar: "TAG_PATTERN",
+						Value:  "",
+						Usage:  "Regular expression release tags have to match",
+					},
+					&cli.StringFlag{
+						Name:   "tag-constraint",
+						EnvVar: "TAG_CONSTRAINT",
+						Value:  "",
+						Usage:  "Semver constraint release tags have to satisfy, non-semver tags are skipped if set",
+					},
+				}, append(commonFlags, registryFlags...)...),
 				Action: func(c *cli.Context) error {
-					outFile := c.String("output-file")
-
 					rf, err := github.NewReleaseFinder(
 						github.WithContext(context.Background()),
 						github.WithRepository(c.String("repository")),
 						github.WithToken(c.String("github-token")),
+						github.WithTokenFile(c.String("github-token-file")),
+						github.WithApp(c.Int64("github-app-id"), c.Int64("github-app-installation-id"), c.String("github-app-private-key-file")),
+						github.WithBaseURL(c.String("github-api-url")),
+						github.WithUploadURL(c.String("github-upload-url")),
+						github.WithCABundleFile(c.String("github-ca-bundle")),
+						github.WithProxy(c.String("github-proxy")),
+						github.WithRateLimitTimeout(c.Duration("rate-limit-timeout")),
+						github.WithCacheDir(c.String("cache-dir")),
+						github.WithCacheMaxStaleness(c.Duration("cache-max-staleness")),
+						github.WithMetadataProfile(release.MetadataProfile(c.String("metadata-profile"))),
+						github.WithMetadataFields(c.StringSlice("metadata-fields")...),
+						github.WithAssetPattern(c.String("asset-pattern")),
+						github.WithAssetType(c.String("asset-type")),
+						github.WithBodyManifest(c.Bool("body-manifest")),
+						github.WithManifestAsset(c.String("manifest-asset")),
 						github.WithVersionPrefix(c.String("version-prefix")),
 						github.WithVersionSuffix(c.String("version-suffix")),
 						github.WithVersionNamePrefix(c.String("version-name-prefix")),
 						github.WithVersionNameSuffix(c.String("version-name-suffix")),
 						github.WithBaseImage(c.String("image-prefix")),
+						github.WithVersionTemplate(c.String("version-template")),
+						github.WithNameTemplate(c.String("name-template")),
+						github.WithImageTemplate(c.String("image-template")),
 						github.WithPreReleases(c.Bool("pre-releases")),
+						github.WithMaxReleases(c.Int("max-releases")),
+						github.WithDrafts(c.Bool("drafts")),
+						github.WithLatestOnly(c.Bool("latest-only")),
+						github.WithPublishedAfter(c.String("published-after")),
+						github.WithPublishedBefore(c.String("published-before")),
+						github.WithTagPattern(c.String("tag-pattern")),
+						github.WithTagConstraint(c.String("tag-constraint")),
+						github.WithDigestPinning(c.Bool("pin-digest")),
+						github.WithMissingImagePolicy(release.MissingImagePolicy(c.String("missing-images"))),
+						github.WithRegistryAuth(c.String("registry-username"), c.String("registry-password")),
+						github.WithRegistryToken(c.String("registry-token")),
+						github.WithRegistryPlainHTTP(c.Bool("plain-http")),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name: "gitlab",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "image-prefix",
+						Value:  "",
+						EnvVar: "IMAGE_PREFIX",
+						Usage:  "Image prefix to use when returning json data",
+					},
+					&cli.StringFlag{
+						Name:   "gitlab-token",
+						EnvVar: "GITLAB_TOKEN",
+						Value:  "",
+						Usage:  "GitLab access token used to fetch releases of private projects",
+					},
+					&cli.StringFlag{
+						Name:   "gitlab-url",
+						EnvVar: "GITLAB_URL",
+						Value:  gitlab.DefaultBaseURL,
+						Usage:  "URL of the GitLab instance, e.g. https://gitlab.example.com",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-prefix",
+						EnvVar: "VERSION_NAME_PREFIX",
+						Value:  "",
+						Usage:  "Version name prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-suffix",
+						EnvVar: "VERSION_NAME_SUFFIX",
+						Value:  "",
+						Usage:  "Version name suffix",
+					},
+					&cli.StringFlag{
+						Name:   "version-prefix",
+						EnvVar: "VERSION_PREFIX",
+						Value:  "",
+						Usage:  "Version prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-suffix",
+						EnvVar: "VERSION_SUFFIX",
+						Value:  "",
+						Usage:  "Version suffix",
+					},
+					&cli.StringFlag{
+						Name:   "repository",
+						EnvVar: "REPOSITORY",
+						Value:  "",
+						Usage:  "GitLab project path or ID to scan releases against, e.g. group/os2",
+					},
+					&cli.BoolFlag{
+						Name:   "pre-releases",
+						Usage:  "Enable upcoming releases in the releases scan",
+						EnvVar: "PRE_RELEASES",
+					},
+					&cli.IntFlag{
+						Name:   "max-releases",
+						EnvVar: "MAX_RELEASES",
+						Value:  0,
+						Usage:  "Maximum number of releases to retrieve from GitLab (0 means all)",
+					},
+				}, append(commonFlags, registryFlags...)...),
+				Action: func(c *cli.Context) error {
+					rf, err := gitlab.NewReleaseFinder(
+						gitlab.WithContext(context.Background()),
+						gitlab.WithRepository(c.String("repository")),
+						gitlab.WithToken(c.String("gitlab-token")),
+						gitlab.WithBaseURL(c.String("gitlab-url")),
+						gitlab.WithVersionPrefix(c.String("version-prefix")),
+						gitlab.WithVersionSuffix(c.String("version-suffix")),
+						gitlab.WithVersionNamePrefix(c.String("version-name-prefix")),
+						gitlab.WithVersionNameSuffix(c.String("version-name-suffix")),
+						gitlab.WithBaseImage(c.String("image-prefix")),
+						gitlab.WithPreReleases(c.Bool("pre-releases")),
+						gitlab.WithMaxReleases(c.Int("max-releases")),
+						gitlab.WithDigestPinning(c.Bool("pin-digest")),
+						gitlab.WithMissingImagePolicy(release.MissingImagePolicy(c.String("missing-images"))),
+						gitlab.WithRegistryAuth(c.String("registry-username"), c.String("registry-password")),
+						gitlab.WithRegistryToken(c.String("registry-token")),
+						gitlab.WithRegistryPlainHTTP(c.Bool("plain-http")),
 					)
 
 					if err != nil {
 						return err
 					}
 
-					b, err := discovery.Versions(rf)
+					d, err := withFilter(c, rf)
 					if err != nil {
 						return err
 					}
 
-					if outFile == "" {
-						fmt.Print(string(b))
-						return nil
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name: "gitea",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "image-prefix",
+						Value:  "",
+						EnvVar: "IMAGE_PREFIX",
+						Usage:  "Image prefix to use when returning json data",
+					},
+					&cli.StringFlag{
+						Name:   "gitea-token",
+						EnvVar: "GITEA_TOKEN",
+						Value:  "",
+						Usage:  "Gitea access token used to fetch releases of private repositories",
+					},
+					&cli.StringFlag{
+						Name:   "gitea-url",
+						EnvVar: "GITEA_URL",
+						Value:  "",
+						Usage:  "URL of the Gitea or Forgejo instance, e.g. https://gitea.example.com",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-prefix",
+						EnvVar: "VERSION_NAME_PREFIX",
+						Value:  "",
+						Usage:  "Version name prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-suffix",
+						EnvVar: "VERSION_NAME_SUFFIX",
+						Value:  "",
+						Usage:  "Version name suffix",
+					},
+					&cli.StringFlag{
+						Name:   "version-prefix",
+						EnvVar: "VERSION_PREFIX",
+						Value:  "",
+						Usage:  "Version prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-suffix",
+						EnvVar: "VERSION_SUFFIX",
+						Value:  "",
+						Usage:  "Version suffix",
+					},
+					&cli.StringFlag{
+						Name:   "repository",
+						EnvVar: "REPOSITORY",
+						Value:  "",
+						Usage:  "Gitea repository to scan releases against, e.g. os/os2",
+					},
+					&cli.BoolFlag{
+						Name:   "pre-releases",
+						Usage:  "Enable pre-releases in the releases scan",
+						EnvVar: "PRE_RELEASES",
+					},
+					&cli.BoolFlag{
+						Name:   "drafts",
+						EnvVar: "DRAFTS",
+						Usage:  "Include draft releases, only visible with a token with write access",
+					},
+					&cli.IntFlag{
+						Name:   "max-releases",
+						EnvVar: "MAX_RELEASES",
+						Value:  0,
+						Usage:  "Maximum number of releases to retrieve from Gitea (0 means all)",
+					},
+				}, append(commonFlags, registryFlags...)...),
+				Action: func(c *cli.Context) error {
+					rf, err := gitea.NewReleaseFinder(
+						gitea.WithContext(context.Background()),
+						gitea.WithRepository(c.String("repository")),
+						gitea.WithToken(c.String("gitea-token")),
+						gitea.WithBaseURL(c.String("gitea-url")),
+						gitea.WithVersionPrefix(c.String("version-prefix")),
+						gitea.WithVersionSuffix(c.String("version-suffix")),
+						gitea.WithVersionNamePrefix(c.String("version-name-prefix")),
+						gitea.WithVersionNameSuffix(c.String("version-name-suffix")),
+						gitea.WithBaseImage(c.String("image-prefix")),
+						gitea.WithPreReleases(c.Bool("pre-releases")),
+						gitea.WithDrafts(c.Bool("drafts")),
+						gitea.WithMaxReleases(c.Int("max-releases")),
+						gitea.WithDigestPinning(c.Bool("pin-digest")),
+						gitea.WithMissingImagePolicy(release.MissingImagePolicy(c.String("missing-images"))),
+						gitea.WithRegistryAuth(c.String("registry-username"), c.String("registry-password")),
+						gitea.WithRegistryToken(c.String("registry-token")),
+						gitea.WithRegistryPlainHTTP(c.Bool("plain-http")),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name:  "http",
+				Usage: "Discover versions from an index of ManagedOSVersion served over HTTP(S)",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "url",
+						EnvVar: "INDEX_URL",
+						Value:  "",
+						Usage:  "URL of the JSON or YAML index listing the versions",
+					},
+					&cli.StringFlag{
+						Name:   "http-username",
+						EnvVar: "HTTP_USERNAME",
+						Value:  "",
+						Usage:  "Username used to fetch the index with basic auth",
+					},
+					&cli.StringFlag{
+						Name:   "http-password",
+						EnvVar: "HTTP_PASSWORD",
+						Value:  "",
+						Usage:  "Password used to fetch the index with basic auth",
+					},
+					&cli.StringFlag{
+						Name:   "http-token",
+						EnvVar: "HTTP_TOKEN",
+						Value:  "",
+						Usage:  "Bearer token used to fetch the index",
+					},
+					&cli.StringFlag{
+						Name:   "ca-bundle",
+						EnvVar: "CA_BUNDLE",
+						Value:  "",
+						Usage:  "PEM file of additional CA certificates to trust",
+					},
+					&cli.StringFlag{
+						Name:   "cache-dir",
+						EnvVar: "CACHE_DIR",
+						Value:  "",
+						Usage:  "Directory to cache the index in, to only download it again once changed",
+					},
+					&cli.StringFlag{
+						Name:   "checksum",
+						EnvVar: "CHECKSUM",
+						Value:  "",
+						Usage:  "Expected SHA-256 or SHA-512 checksum of the index, e.g. sha256:2c26b46b...",
+					},
+					&cli.StringFlag{
+						Name:   "checksum-url",
+						EnvVar: "CHECKSUM_URL",
+						Value:  "",
+						Usage:  "URL of a sha256sum file holding the checksum of the index",
+					},
+					&cli.StringFlag{
+						Name:   "signature-url",
+						EnvVar: "SIGNATURE_URL",
+						Value:  "",
+						Usage:  "URL of the detached signature of the index (defaults to the index URL with a .sig extension)",
+					},
+					&cli.StringFlag{
+						Name:   "public-key-file",
+						EnvVar: "PUBLIC_KEY_FILE",
+						Value:  "",
+						Usage:  "PEM public key verifying the signature of the index",
+					},
+					&cli.BoolFlag{
+						Name:   "strict",
+						EnvVar: "STRICT",
+						Usage:  "Fail on invalid versions instead of skipping them",
+					},
+				}, commonFlags...),
+				Action: func(c *cli.Context) error {
+					rf, err := index.NewIndexFinder(
+						index.WithContext(context.Background()),
+						index.WithURL(c.String("url")),
+						index.WithBasicAuth(c.String("http-username"), c.String("http-password")),
+						index.WithToken(c.String("http-token")),
+						index.WithCABundleFile(c.String("ca-bundle")),
+						index.WithCacheDir(c.String("cache-dir")),
+						index.WithChecksum(c.String("checksum")),
+						index.WithChecksumURL(c.String("checksum-url")),
+						index.WithSignatureURL(c.String("signature-url")),
+						index.WithPublicKeyFile(c.String("public-key-file")),
+						index.WithStrict(c.Bool("strict")),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name:  "local",
+				Usage: "Discover versions from ManagedOSVersion files of a local directory",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "path",
+						EnvVar: "VERSIONS_PATH",
+						Value:  "",
+						Usage:  "Directory to retrieve version files from, or a single version file",
+					},
+					&cli.StringSliceFlag{
+						Name:   "include-files",
+						EnvVar: "INCLUDE_FILES",
+						Usage:  "Glob patterns of the version files to parse (default: *.json, *.yaml, *.yml)",
+					},
+					&cli.StringSliceFlag{
+						Name:   "exclude-files",
+						EnvVar: "EXCLUDE_FILES",
+						Usage:  "Glob patterns of the files to ignore",
+					},
+					&cli.BoolFlag{
+						Name:   "strict",
+						EnvVar: "STRICT",
+						Usage:  "Fail if any version file is invalid instead of skipping it",
+					},
+				}, commonFlags...),
+				Action: func(c *cli.Context) error {
+					rf, err := local.NewReleaseFinder(
+						local.WithPath(c.String("path")),
+						local.WithStrict(c.Bool("strict")),
+						local.WithInclude(c.StringSlice("include-files")...),
+						local.WithExclude(c.StringSlice("exclude-files")...),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name:  "helm",
+				Usage: "Discover versions from the versions of a Helm chart",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "repository",
+						EnvVar: "REPOSITORY",
+						Value:  "",
+						Usage:  "Chart repository: HTTP(S) URL, local index.yaml or oci:// repository",
+					},
+					&cli.StringFlag{
+						Name:   "chart",
+						EnvVar: "CHART",
+						Value:  "",
+						Usage:  "Name of the chart to list the versions of",
+					},
+					&cli.StringFlag{
+						Name:   "chart-constraint",
+						EnvVar: "CHART_CONSTRAINT",
+						Value:  "",
+						Usage:  "Semver constraint chart versions have to satisfy",
+					},
+					&cli.StringFlag{
+						Name:   "helm-username",
+						EnvVar: "HELM_USERNAME",
+						Value:  "",
+						Usage:  "Username used to authenticate against the chart repository",
+					},
+					&cli.StringFlag{
+						Name:   "helm-password",
+						EnvVar: "HELM_PASSWORD",
+						Value:  "",
+						Usage:  "Password used to authenticate against the chart repository",
+					},
+					&cli.StringFlag{
+						Name:   "helm-token",
+						EnvVar: "HELM_TOKEN",
+						Value:  "",
+						Usage:  "Bearer token used to authenticate against the chart repository",
+					},
+					&cli.BoolFlag{
+						Name:   "helm-plain-http",
+						EnvVar: "HELM_PLAIN_HTTP",
+						Usage:  "Use plain HTTP instead of HTTPS to talk to an OCI chart repository",
+					},
+					&cli.StringFlag{
+						Name:   "image-prefix",
+						Value:  "",
+						EnvVar: "IMAGE_PREFIX",
+						Usage:  "Image the app versions are appended to as a tag",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-prefix",
+						EnvVar: "VERSION_NAME_PREFIX",
+						Value:  "",
+						Usage:  "Version name prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-suffix",
+						EnvVar: "VERSION_NAME_SUFFIX",
+						Value:  "",
+						Usage:  "Version name suffix",
+					},
+					&cli.StringFlag{
+						Name:   "version-prefix",
+						EnvVar: "VERSION_PREFIX",
+						Value:  "",
+						Usage:  "Version prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-suffix",
+						EnvVar: "VERSION_SUFFIX",
+						Value:  "",
+						Usage:  "Version suffix",
+					},
+					&cli.StringFlag{
+						Name:   "version-template",
+						EnvVar: "VERSION_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the versions, replacing the version prefix and suffix",
+					},
+					&cli.StringFlag{
+						Name:   "name-template",
+						EnvVar: "NAME_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the version names, replacing the version name prefix and suffix",
+					},
+					&cli.StringFlag{
+						Name:   "image-template",
+						EnvVar: "IMAGE_TEMPLATE",
+						Value:  "",
+						Usage:  "Go template of the upgrade images, replacing the image prefix",
+					},
+				}, append(commonFlags, registryFlags...)...),
+				Action: func(c *cli.Context) error {
+					rf, err := helm.NewReleaseFinder(
+						helm.WithContext(context.Background()),
+						helm.WithRepository(c.String("repository")),
+						helm.WithChart(c.String("chart")),
+						helm.WithChartConstraint(c.String("chart-constraint")),
+						helm.WithBasicAuth(c.String("helm-username"), c.String("helm-password")),
+						helm.WithToken(c.String("helm-token")),
+						helm.WithPlainHTTP(c.Bool("helm-plain-http")),
+						helm.WithBaseImage(c.String("image-prefix")),
+						helm.WithVersionPrefix(c.String("version-prefix")),
+						helm.WithVersionSuffix(c.String("version-suffix")),
+						helm.WithVersionNamePrefix(c.String("version-name-prefix")),
+						helm.WithVersionNameSuffix(c.String("version-name-suffix")),
+						helm.WithVersionTemplate(c.String("version-template")),
+						helm.WithNameTemplate(c.String("name-template")),
+						helm.WithImageTemplate(c.String("image-template")),
+						helm.WithDigestPinning(c.Bool("pin-digest")),
+						helm.WithMissingImagePolicy(release.MissingImagePolicy(c.String("missing-images"))),
+						helm.WithRegistryAuth(c.String("registry-username"), c.String("registry-password")),
+						helm.WithRegistryToken(c.String("registry-token")),
+						helm.WithRegistryPlainHTTP(c.Bool("plain-http")),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name: "registry",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "repository",
+						EnvVar: "REPOSITORY",
+						Value:  "quay.io/costoolkit/os2",
+						Usage:  "Image repository to scan tags against",
+					},
+					&cli.StringFlag{
+						Name:   "tag-pattern",
+						EnvVar: "TAG_PATTERN",
+						Value:  "",
+						Usage:  "Regular expression tags have to match",
+					},
+					&cli.StringFlag{
+						Name:   "tag-constraint",
+						EnvVar: "TAG_CONSTRAINT",
+						Value:  "",
+						Usage:  "Semver constraint tags have to satisfy, non-semver tags are skipped if set",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-prefix",
+						EnvVar: "VERSION_NAME_PREFIX",
+						Value:  "",
+						Usage:  "Version name prefix",
+					},
+					&cli.StringFlag{
+						Name:   "version-name-suffix",
+						EnvVar: "VERSION_NAME_SUFFIX",
+						Value:  "",
+						Usage:  "Version name suffix",
+					},
+				}, append(commonFlags, registryFlags...)...),
+				Action: func(c *cli.Context) error {
+					rf, err := registry.NewReleaseFinder(
+						registry.WithContext(context.Background()),
+						registry.WithRepository(c.String("repository")),
+						registry.WithBasicAuth(c.String("registry-username"), c.String("registry-password")),
+						registry.WithToken(c.String("registry-token")),
+						registry.WithPlainHTTP(c.Bool("plain-http")),
+						registry.WithTagPattern(c.String("tag-pattern")),
+						registry.WithTagConstraint(c.String("tag-constraint")),
+						registry.WithVersionNamePrefix(c.String("version-name-prefix")),
+						registry.WithVersionNameSuffix(c.String("version-name-suffix")),
+						registry.WithDigestPinning(c.Bool("pin-digest")),
+						registry.WithMissingImagePolicy(release.MissingImagePolicy(c.String("missing-images"))),
+					)
+
+					if err != nil {
+						return err
+					}
+
+					d, err := withFilter(c, rf)
+					if err != nil {
+						return err
+					}
+
+					return writeVersions(c.String("output-file"), discovery.ConflictPolicy(c.String("on-conflict")), discovery.NamePolicy(c.String("name-policy")), d)
+				},
+			},
+			{
+				Name:  "multi",
+				Usage: "Discover versions from several sources described in a YAML or JSON configuration file",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:   "config",
+						EnvVar: "CONFIG_FILE",
+						Value:  "",
+						Usage:  "Configuration file describing the sources to discover versions from",
+					},
+				}, outputFlags...),
+				Action: func(c *cli.Context) error {
+					cfg, err := config.Load(c.String("config"))
+					if err != nil {
+						return err
+					}
+
+					d, err := cfg.Discoverers()
+					if err != nil {
+						return err
+					}
+
+					// the flags only override the configuration file when they're set
+					policy := cfg.OnConflict
+					if c.IsSet("on-conflict") {
+						policy = discovery.ConflictPolicy(c.String("on-conflict"))
+					}
+
+					names := cfg.NamePolicy
+					if c.IsSet("name-policy") {
+						names = discovery.NamePolicy(c.String("name-policy"))
 					}
 
-					return ioutil.WriteFile(outFile, b, os.ModePerm)
+					return writeVersions(c.String("output-file"), policy, names, d...)
 				},
 			},
 		},
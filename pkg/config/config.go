@@ -0,0 +1,546 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	discovery "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	git "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/git"
+	gitea "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitea"
+	github "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/github"
+	gitlab "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitlab"
+	helm "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/helm"
+	index "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/index"
+	local "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/local"
+	registry "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config describes a set of sources to discover versions from
+type Config struct {
+	// OnConflict sets the policy for versions with the same name found in different sources
+	OnConflict discovery.ConflictPolicy `json:"onConflict,omitempty"`
+	// NamePolicy sets the policy for versions whose name isn't a valid Kubernetes object name
+	NamePolicy discovery.NamePolicy `json:"namePolicy,omitempty"`
+	Sources    []Source             `json:"sources"`
+}
+
+// Source describes a single discovery source. Exactly one of the source types has to be set
+type Source struct {
+	// Name identifies the source in error messages
+	Name   string  `json:"name,omitempty"`
+	Filter *Filter `json:"filter,omitempty"`
+
+	Git      *Git      `json:"git,omitempty"`
+	Github   *Github   `json:"github,omitempty"`
+	Gitlab   *Gitlab   `json:"gitlab,omitempty"`
+	Gitea    *Gitea    `json:"gitea,omitempty"`
+	HTTP     *HTTP     `json:"http,omitempty"`
+	Local    *Local    `json:"local,omitempty"`
+	Helm     *Helm     `json:"helm,omitempty"`
+	Registry *Registry `json:"registry,omitempty"`
+}
+
+// Filter holds the version filter settings of a source
+type Filter struct {
+	VersionConstraint string                    `json:"versionConstraint,omitempty"`
+	KeepLatest        int                       `json:"keepLatest,omitempty"`
+	Exclude           string                    `json:"exclude,omitempty"`
+	NonSemver         discovery.NonSemverPolicy `json:"nonSemver,omitempty"`
+}
+
+// Git holds the settings of a git source
+type Git struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch,omitempty"`
+	Subpath    string `json:"subpath,omitempty"`
+
+	Username              string `json:"username,omitempty"`
+	Password              string `json:"password,omitempty"`
+	Token                 string `json:"token,omitempty"`
+	SSHUser               string `json:"sshUser,omitempty"`
+	SSHKey                string `json:"sshKey,omitempty"`
+	SSHKeyFile            string `json:"sshKeyFile,omitempty"`
+	SSHKeyPassphrase      string `json:"sshKeyPassphrase,omitempty"`
+	KnownHostsFile        string `json:"knownHostsFile,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"`
+
+	Strict       bool     `json:"strict,omitempty"`
+	IncludeFiles []string `json:"includeFiles,omitempty"`
+	ExcludeFiles []string `json:"excludeFiles,omitempty"`
+
+	Tags              bool   `json:"tags,omitempty"`
+	TagPattern        string `json:"tagPattern,omitempty"`
+	TagConstraint     string `json:"tagConstraint,omitempty"`
+	ImagePrefix       string `json:"imagePrefix,omitempty"`
+	VersionPrefix     string `json:"versionPrefix,omitempty"`
+	VersionSuffix     string `json:"versionSuffix,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+}
+
+// Github holds the settings of a github source
+type Github struct {
+	Repository        string `json:"repository"`
+	Token             string `json:"token,omitempty"`
+	TokenFile         string `json:"tokenFile,omitempty"`
+	AppID             int64  `json:"appID,omitempty"`
+	AppInstallationID int64  `json:"appInstallationID,omitempty"`
+	AppPrivateKeyFile string `json:"appPrivateKeyFile,omitempty"`
+	ImagePrefix       string `json:"imagePrefix,omitempty"`
+	VersionPrefix     string `json:"versionPrefix,omitempty"`
+	VersionSuffix     string `json:"versionSuffix,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+	VersionTemplate   string `json:"versionTemplate,omitempty"`
+	NameTemplate      string `json:"nameTemplate,omitempty"`
+	ImageTemplate     string `json:"imageTemplate,omitempty"`
+	PreReleases       bool   `json:"preReleases,omitempty"`
+	MaxReleases       int    `json:"maxReleases,omitempty"`
+	Drafts            bool   `json:"drafts,omitempty"`
+	LatestOnly        bool   `json:"latestOnly,omitempty"`
+	PublishedAfter    string `json:"publishedAfter,omitempty"`
+	PublishedBefore   string `json:"publishedBefore,omitempty"`
+	TagPattern        string `json:"tagPattern,omitempty"`
+	TagConstraint     string `json:"tagConstraint,omitempty"`
+	APIURL            string `json:"apiURL,omitempty"`
+	UploadURL         string `json:"uploadURL,omitempty"`
+	CABundleFile      string `json:"caBundleFile,omitempty"`
+	Proxy             string `json:"proxy,omitempty"`
+
+	RateLimitTimeout  *metav1.Duration `json:"rateLimitTimeout,omitempty"`
+	CacheDir          string           `json:"cacheDir,omitempty"`
+	CacheMaxStaleness *metav1.Duration `json:"cacheMaxStaleness,omitempty"`
+
+	MetadataProfile release.MetadataProfile `json:"metadataProfile,omitempty"`
+	MetadataFields  []string                `json:"metadataFields,omitempty"`
+
+	AssetPattern string `json:"assetPattern,omitempty"`
+	AssetType    string `json:"assetType,omitempty"`
+
+	BodyManifest  bool   `json:"bodyManifest,omitempty"`
+	ManifestAsset string `json:"manifestAsset,omitempty"`
+
+	PinDigest         bool                       `json:"pinDigest,omitempty"`
+	MissingImages     release.MissingImagePolicy `json:"missingImages,omitempty"`
+	RegistryUsername  string                     `json:"registryUsername,omitempty"`
+	RegistryPassword  string                     `json:"registryPassword,omitempty"`
+	RegistryToken     string                     `json:"registryToken,omitempty"`
+	RegistryPlainHTTP bool                       `json:"registryPlainHTTP,omitempty"`
+}
+
+// Gitlab holds the settings of a GitLab source
+type Gitlab struct {
+	Repository        string `json:"repository"`
+	BaseURL           string `json:"baseURL,omitempty"`
+	Token             string `json:"token,omitempty"`
+	ImagePrefix       string `json:"imagePrefix,omitempty"`
+	VersionPrefix     string `json:"versionPrefix,omitempty"`
+	VersionSuffix     string `json:"versionSuffix,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+	PreReleases       bool   `json:"preReleases,omitempty"`
+	MaxReleases       int    `json:"maxReleases,omitempty"`
+
+	PinDigest         bool                       `json:"pinDigest,omitempty"`
+	MissingImages     release.MissingImagePolicy `json:"missingImages,omitempty"`
+	RegistryUsername  string                     `json:"registryUsername,omitempty"`
+	RegistryPassword  string                     `json:"registryPassword,omitempty"`
+	RegistryToken     string                     `json:"registryToken,omitempty"`
+	RegistryPlainHTTP bool                       `json:"registryPlainHTTP,omitempty"`
+}
+
+// Gitea holds the settings of a Gitea or Forgejo source
+type Gitea struct {
+	Repository        string `json:"repository"`
+	BaseURL           string `json:"baseURL"`
+	Token             string `json:"token,omitempty"`
+	ImagePrefix       string `json:"imagePrefix,omitempty"`
+	VersionPrefix     string `json:"versionPrefix,omitempty"`
+	VersionSuffix     string `json:"versionSuffix,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+	PreReleases       bool   `json:"preReleases,omitempty"`
+	Drafts            bool   `json:"drafts,omitempty"`
+	MaxReleases       int    `json:"maxReleases,omitempty"`
+
+	PinDigest         bool                       `json:"pinDigest,omitempty"`
+	MissingImages     release.MissingImagePolicy `json:"missingImages,omitempty"`
+	RegistryUsername  string                     `json:"registryUsername,omitempty"`
+	RegistryPassword  string                     `json:"registryPassword,omitempty"`
+	RegistryToken     string                     `json:"registryToken,omitempty"`
+	RegistryPlainHTTP bool                       `json:"registryPlainHTTP,omitempty"`
+}
+
+// HTTP holds the settings of an index served over HTTP(S)
+type HTTP struct {
+	URL           string `json:"url"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Token         string `json:"token,omitempty"`
+	CABundleFile  string `json:"caBundleFile,omitempty"`
+	CacheDir      string `json:"cacheDir,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+	ChecksumURL   string `json:"checksumURL,omitempty"`
+	SignatureURL  string `json:"signatureURL,omitempty"`
+	PublicKeyFile string `json:"publicKeyFile,omitempty"`
+	Strict        bool   `json:"strict,omitempty"`
+}
+
+// Local holds the settings of a local directory or file source
+type Local struct {
+	Path         string   `json:"path"`
+	Strict       bool     `json:"strict,omitempty"`
+	IncludeFiles []string `json:"includeFiles,omitempty"`
+	ExcludeFiles []string `json:"excludeFiles,omitempty"`
+}
+
+// Helm holds the settings of a Helm chart source
+type Helm struct {
+	Repository        string `json:"repository"`
+	Chart             string `json:"chart"`
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"`
+	Token             string `json:"token,omitempty"`
+	PlainHTTP         bool   `json:"plainHTTP,omitempty"`
+	ChartConstraint   string `json:"chartConstraint,omitempty"`
+	ImagePrefix       string `json:"imagePrefix,omitempty"`
+	VersionPrefix     string `json:"versionPrefix,omitempty"`
+	VersionSuffix     string `json:"versionSuffix,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+	VersionTemplate   string `json:"versionTemplate,omitempty"`
+	NameTemplate      string `json:"nameTemplate,omitempty"`
+	ImageTemplate     string `json:"imageTemplate,omitempty"`
+
+	PinDigest         bool                       `json:"pinDigest,omitempty"`
+	MissingImages     release.MissingImagePolicy `json:"missingImages,omitempty"`
+	RegistryUsername  string                     `json:"registryUsername,omitempty"`
+	RegistryPassword  string                     `json:"registryPassword,omitempty"`
+	RegistryToken     string                     `json:"registryToken,omitempty"`
+	RegistryPlainHTTP bool                       `json:"registryPlainHTTP,omitempty"`
+}
+
+// Registry holds the settings of a container registry source
+type Registry struct {
+	Repository        string `json:"repository"`
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"`
+	Token             string `json:"token,omitempty"`
+	PlainHTTP         bool   `json:"plainHTTP,omitempty"`
+	TagPattern        string `json:"tagPattern,omitempty"`
+	TagConstraint     string `json:"tagConstraint,omitempty"`
+	VersionNamePrefix string `json:"versionNamePrefix,omitempty"`
+	VersionNameSuffix string `json:"versionNameSuffix,omitempty"`
+
+	PinDigest     bool                       `json:"pinDigest,omitempty"`
+	MissingImages release.MissingImagePolicy `json:"missingImages,omitempty"`
+}
+
+// Load reads a YAML or JSON configuration file
+func Load(path string) (*Config, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(dat)
+}
+
+// Parse decodes a YAML or JSON configuration
+func Parse(dat []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(dat, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if len(c.Sources) == 0 {
+		return nil, fmt.Errorf("invalid configuration: no sources defined")
+	}
+	return c, nil
+}
+
+// Discoverers builds the discoverers of all the configured sources
+func (c *Config) Discoverers() ([]discovery.Discoverer, error) {
+	var res []discovery.Discoverer
+	for i, s := range c.Sources {
+		d, err := s.Discoverer()
+		if err != nil {
+			name := s.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			return nil, fmt.Errorf("source %s: %w", name, err)
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// Discoverer builds the discoverer of the source, wrapped by its version filter and named after the source
+func (s Source) Discoverer() (discovery.Discoverer, error) {
+	d, err := s.discoverer()
+	if err != nil || s.Name == "" {
+		return d, err
+	}
+	return discovery.Named(s.Name, d), nil
+}
+
+func (s Source) discoverer() (discovery.Discoverer, error) {
+	var builders []func() (discovery.Discoverer, error)
+	if s.Git != nil {
+		builders = append(builders, s.Git.discoverer)
+	}
+	if s.Github != nil {
+		builders = append(builders, s.Github.discoverer)
+	}
+	if s.Gitlab != nil {
+		builders = append(builders, s.Gitlab.discoverer)
+	}
+	if s.Gitea != nil {
+		builders = append(builders, s.Gitea.discoverer)
+	}
+	if s.HTTP != nil {
+		builders = append(builders, s.HTTP.discoverer)
+	}
+	if s.Local != nil {
+		builders = append(builders, s.Local.discoverer)
+	}
+	if s.Helm != nil {
+		builders = append(builders, s.Helm.discoverer)
+	}
+	if s.Registry != nil {
+		builders = append(builders, s.Registry.discoverer)
+	}
+	if len(builders) != 1 {
+		return nil, fmt.Errorf("exactly one source type has to be set, found %d", len(builders))
+	}
+
+	d, err := builders[0]()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Filter == nil {
+		return d, nil
+	}
+
+	return discovery.NewFilter(d,
+		discovery.WithConstraint(s.Filter.VersionConstraint),
+		discovery.WithKeepLatest(s.Filter.KeepLatest),
+		discovery.WithExclude(s.Filter.Exclude),
+		discovery.WithNonSemverPolicy(s.Filter.NonSemver),
+	)
+}
+
+func (g *Git) discoverer() (discovery.Discoverer, error) {
+	return git.NewReleaseFinder(
+		git.WithRepository(g.Repository),
+		git.WithSubpath(g.Subpath),
+		git.WithBranch(g.Branch),
+		git.WithBasicAuth(g.Username, g.Password),
+		git.WithToken(g.Token),
+		git.WithSSHUser(g.SSHUser),
+		git.WithSSHKey(g.SSHKey),
+		git.WithSSHKeyFile(g.SSHKeyFile),
+		git.WithSSHKeyPassphrase(g.SSHKeyPassphrase),
+		git.WithKnownHostsFile(g.KnownHostsFile),
+		git.WithInsecureIgnoreHostKey(g.InsecureIgnoreHostKey),
+		git.WithStrict(g.Strict),
+		git.WithInclude(g.IncludeFiles...),
+		git.WithExclude(g.ExcludeFiles...),
+		git.WithTags(g.Tags),
+		git.WithTagPattern(g.TagPattern),
+		git.WithTagConstraint(g.TagConstraint),
+		git.WithBaseImage(g.ImagePrefix),
+		git.WithVersionPrefix(g.VersionPrefix),
+		git.WithVersionSuffix(g.VersionSuffix),
+		git.WithVersionNamePrefix(g.VersionNamePrefix),
+		git.WithVersionNameSuffix(g.VersionNameSuffix),
+	)
+}
+
+func (g *Github) rateLimitTimeout() time.Duration {
+	if g.RateLimitTimeout == nil {
+		return github.DefaultRateLimitTimeout
+	}
+	return g.RateLimitTimeout.Duration
+}
+
+func (g *Github) cacheMaxStaleness() time.Duration {
+	if g.CacheMaxStaleness == nil {
+		return github.DefaultCacheMaxStaleness
+	}
+	return g.CacheMaxStaleness.Duration
+}
+
+func (g *Github) discoverer() (discovery.Discoverer, error) {
+	return github.NewReleaseFinder(
+		github.WithContext(context.Background()),
+		github.WithRepository(g.Repository),
+		github.WithToken(g.Token),
+		github.WithTokenFile(g.TokenFile),
+		github.WithApp(g.AppID, g.AppInstallationID, g.AppPrivateKeyFile),
+		github.WithBaseURL(g.APIURL),
+		github.WithUploadURL(g.UploadURL),
+		github.WithCABundleFile(g.CABundleFile),
+		github.WithProxy(g.Proxy),
+		github.WithRateLimitTimeout(g.rateLimitTimeout()),
+		github.WithCacheDir(g.CacheDir),
+		github.WithCacheMaxStaleness(g.cacheMaxStaleness()),
+		github.WithMetadataProfile(g.MetadataProfile),
+		github.WithMetadataFields(g.MetadataFields...),
+		github.WithAssetPattern(g.AssetPattern),
+		github.WithAssetType(g.AssetType),
+		github.WithBodyManifest(g.BodyManifest),
+		github.WithManifestAsset(g.ManifestAsset),
+		github.WithVersionPrefix(g.VersionPrefix),
+		github.WithVersionSuffix(g.VersionSuffix),
+		github.WithVersionNamePrefix(g.VersionNamePrefix),
+		github.WithVersionNameSuffix(g.VersionNameSuffix),
+		github.WithBaseImage(g.ImagePrefix),
+		github.WithVersionTemplate(g.VersionTemplate),
+		github.WithNameTemplate(g.NameTemplate),
+		github.WithImageTemplate(g.ImageTemplate),
+		github.WithPreReleases(g.PreReleases),
+		github.WithMaxReleases(g.MaxReleases),
+		github.WithDrafts(g.Drafts),
+		github.WithLatestOnly(g.LatestOnly),
+		github.WithPublishedAfter(g.PublishedAfter),
+		github.WithPublishedBefore(g.PublishedBefore),
+		github.WithTagPattern(g.TagPattern),
+		github.WithTagConstraint(g.TagConstraint),
+		github.WithDigestPinning(g.PinDigest),
+		github.WithMissingImagePolicy(g.MissingImages),
+		github.WithRegistryAuth(g.RegistryUsername, g.RegistryPassword),
+		github.WithRegistryToken(g.RegistryToken),
+		github.WithRegistryPlainHTTP(g.RegistryPlainHTTP),
+	)
+}
+
+func (g *Gitlab) discoverer() (discovery.Discoverer, error) {
+	return gitlab.NewReleaseFinder(
+		gitlab.WithContext(context.Background()),
+		gitlab.WithRepository(g.Repository),
+		gitlab.WithBaseURL(g.BaseURL),
+		gitlab.WithToken(g.Token),
+		gitlab.WithVersionPrefix(g.VersionPrefix),
+		gitlab.WithVersionSuffix(g.VersionSuffix),
+		gitlab.WithVersionNamePrefix(g.VersionNamePrefix),
+		gitlab.WithVersionNameSuffix(g.VersionNameSuffix),
+		gitlab.WithBaseImage(g.ImagePrefix),
+		gitlab.WithPreReleases(g.PreReleases),
+		gitlab.WithMaxReleases(g.MaxReleases),
+		gitlab.WithDigestPinning(g.PinDigest),
+		gitlab.WithMissingImagePolicy(g.MissingImages),
+		gitlab.WithRegistryAuth(g.RegistryUsername, g.RegistryPassword),
+		gitlab.WithRegistryToken(g.RegistryToken),
+		gitlab.WithRegistryPlainHTTP(g.RegistryPlainHTTP),
+	)
+}
+
+func (g *Gitea) discoverer() (discovery.Discoverer, error) {
+	return gitea.NewReleaseFinder(
+		gitea.WithContext(context.Background()),
+		gitea.WithRepository(g.Repository),
+		gitea.WithBaseURL(g.BaseURL),
+		gitea.WithToken(g.Token),
+		gitea.WithVersionPrefix(g.VersionPrefix),
+		gitea.WithVersionSuffix(g.VersionSuffix),
+		gitea.WithVersionNamePrefix(g.VersionNamePrefix),
+		gitea.WithVersionNameSuffix(g.VersionNameSuffix),
+		gitea.WithBaseImage(g.ImagePrefix),
+		gitea.WithPreReleases(g.PreReleases),
+		gitea.WithDrafts(g.Drafts),
+		gitea.WithMaxReleases(g.MaxReleases),
+		gitea.WithDigestPinning(g.PinDigest),
+		gitea.WithMissingImagePolicy(g.MissingImages),
+		gitea.WithRegistryAuth(g.RegistryUsername, g.RegistryPassword),
+		gitea.WithRegistryToken(g.RegistryToken),
+		gitea.WithRegistryPlainHTTP(g.RegistryPlainHTTP),
+	)
+}
+
+func (h *HTTP) discoverer() (discovery.Discoverer, error) {
+	return index.NewIndexFinder(
+		index.WithContext(context.Background()),
+		index.WithURL(h.URL),
+		index.WithBasicAuth(h.Username, h.Password),
+		index.WithToken(h.Token),
+		index.WithCABundleFile(h.CABundleFile),
+		index.WithCacheDir(h.CacheDir),
+		index.WithChecksum(h.Checksum),
+		index.WithChecksumURL(h.ChecksumURL),
+		index.WithSignatureURL(h.SignatureURL),
+		index.WithPublicKeyFile(h.PublicKeyFile),
+		index.WithStrict(h.Strict),
+	)
+}
+
+func (l *Local) discoverer() (discovery.Discoverer, error) {
+	return local.NewReleaseFinder(
+		local.WithPath(l.Path),
+		local.WithStrict(l.Strict),
+		local.WithInclude(l.IncludeFiles...),
+		local.WithExclude(l.ExcludeFiles...),
+	)
+}
+
+func (h *Helm) discoverer() (discovery.Discoverer, error) {
+	return helm.NewReleaseFinder(
+		helm.WithContext(context.Background()),
+		helm.WithRepository(h.Repository),
+		helm.WithChart(h.Chart),
+		helm.WithBasicAuth(h.Username, h.Password),
+		helm.WithToken(h.Token),
+		helm.WithPlainHTTP(h.PlainHTTP),
+		helm.WithChartConstraint(h.ChartConstraint),
+		helm.WithBaseImage(h.ImagePrefix),
+		helm.WithVersionPrefix(h.VersionPrefix),
+		helm.WithVersionSuffix(h.VersionSuffix),
+		helm.WithVersionNamePrefix(h.VersionNamePrefix),
+		helm.WithVersionNameSuffix(h.VersionNameSuffix),
+		helm.WithVersionTemplate(h.VersionTemplate),
+		helm.WithNameTemplate(h.NameTemplate),
+		helm.WithImageTemplate(h.ImageTemplate),
+		helm.WithDigestPinning(h.PinDigest),
+		helm.WithMissingImagePolicy(h.MissingImages),
+		helm.WithRegistryAuth(h.RegistryUsername, h.RegistryPassword),
+		helm.WithRegistryToken(h.RegistryToken),
+		helm.WithRegistryPlainHTTP(h.RegistryPlainHTTP),
+	)
+}
+
+func (r *Registry) discoverer() (discovery.Discoverer, error) {
+	return registry.NewReleaseFinder(
+		registry.WithContext(context.Background()),
+		registry.WithRepository(r.Repository),
+		registry.WithBasicAuth(r.Username, r.Password),
+		registry.WithToken(r.Token),
+		registry.WithPlainHTTP(r.PlainHTTP),
+		registry.WithTagPattern(r.TagPattern),
+		registry.WithTagConstraint(r.TagConstraint),
+		registry.WithVersionNamePrefix(r.VersionNamePrefix),
+		registry.WithVersionNameSuffix(r.VersionNameSuffix),
+		registry.WithDigestPinning(r.PinDigest),
+		registry.WithMissingImagePolicy(r.MissingImages),
+	)
+}
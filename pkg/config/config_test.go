@@ -0,0 +1,122 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/config"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+)
+
+const yamlConfig = `
+onConflict: last
+sources:
+- name: stable
+  github:
+    repository: rancher-sandbox/os2
+    imagePrefix: quay.io/costoolkit/os2
+    maxReleases: 10
+    rateLimitTimeout: 10m
+  filter:
+    versionConstraint: ">=v0.1.0"
+    keepLatest: 2
+- name: hotfixes
+  git:
+    repository: https://github.com/rancher-sandbox/upgradechannel-discovery-test-repo
+    subpath: sub
+- name: flavours
+  gitlab:
+    repository: os/flavours
+    baseURL: https://gitlab.example.com
+`
+
+var _ = Describe("config", func() {
+	Context("parsing", func() {
+		It("parses YAML configurations", func() {
+			c, err := Parse([]byte(yamlConfig))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(c.OnConflict).To(Equal(discovery.ConflictLastWins))
+			Expect(len(c.Sources)).To(Equal(3))
+			Expect(c.Sources[0].Github.Repository).To(Equal("rancher-sandbox/os2"))
+			Expect(c.Sources[0].Github.MaxReleases).To(Equal(10))
+			Expect(c.Sources[0].Github.RateLimitTimeout.Duration).To(Equal(10 * time.Minute))
+			Expect(c.Sources[0].Filter.KeepLatest).To(Equal(2))
+			Expect(c.Sources[1].Git.Subpath).To(Equal("sub"))
+			Expect(c.Sources[2].Gitlab.BaseURL).To(Equal("https://gitlab.example.com"))
+
+			d, err := c.Discoverers()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(d)).To(Equal(3))
+		})
+
+		It("loads JSON configuration files", func() {
+			dir, err := os.MkdirTemp("", "config")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "config.json")
+			err = ioutil.WriteFile(path, []byte(`{"sources": [{"git": {"repository": "foo"}}]}`), os.ModePerm)
+			Expect(err).ToNot(HaveOccurred())
+
+			c, err := Load(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Sources[0].Git.Repository).To(Equal("foo"))
+		})
+
+		It("fails on unknown fields", func() {
+			_, err := Parse([]byte(`{"sources": [{"git": {"repo": "foo"}}]}`))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails without sources", func() {
+			_, err := Parse([]byte(`onConflict: first`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("discoverers", func() {
+		It("requires exactly one type per source", func() {
+			c, err := Parse([]byte(`{"sources": [{"name": "both", "git": {"repository": "foo"}, "github": {"repository": "foo/bar"}}]}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = c.Discoverers()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("both"))
+
+			c, err = Parse([]byte(`{"sources": [{"name": "none"}]}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = c.Discoverers()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails on invalid filters", func() {
+			c, err := Parse([]byte(`{"sources": [{"git": {"repository": "foo"}, "filter": {"nonSemver": "foo"}}]}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = c.Discoverers()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
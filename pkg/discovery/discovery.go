@@ -18,26 +18,137 @@ package discovery
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/hashicorp/go-multierror"
 	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
 )
 
 type Discoverer interface {
 	Discovery() (res []*provv1.ManagedOSVersion, err error)
 }
 
+// ConflictPolicy defines how versions with the same name returned by the discoverers are handled
+type ConflictPolicy string
+
+const (
+	// ConflictFirstWins keeps the first version found with a given name
+	ConflictFirstWins ConflictPolicy = "first"
+	// ConflictLastWins keeps the last version found with a given name
+	ConflictLastWins ConflictPolicy = "last"
+	// ConflictError keeps the first version found and reports an error for the duplicates
+	ConflictError ConflictPolicy = "error"
+	// ConflictMerge keeps the first version found, adding the metadata keys it lacks from the duplicates
+	ConflictMerge ConflictPolicy = "merge"
+)
+
+type collectorOptions struct {
+	conflictPolicy ConflictPolicy
+	namePolicy     NamePolicy
+}
+
+type collectorSetting func(c *collectorOptions) error
+
+// WithConflictPolicy sets how versions with the same name are handled
+func WithConflictPolicy(p ConflictPolicy) collectorSetting { //nolint:golint,revive
+	return func(c *collectorOptions) error {
+		switch p {
+		case "":
+			return nil
+		case ConflictFirstWins, ConflictLastWins, ConflictError, ConflictMerge:
+			c.conflictPolicy = p
+			return nil
+		default:
+			return fmt.Errorf("invalid conflict policy '%s', must be one of: %s, %s, %s, %s", p, ConflictFirstWins, ConflictLastWins, ConflictError, ConflictMerge)
+		}
+	}
+}
+
+// WithNamePolicy sets how versions whose name isn't a valid Kubernetes object name are handled
+func WithNamePolicy(p NamePolicy) collectorSetting { //nolint:golint,revive
+	return func(c *collectorOptions) error {
+		switch p {
+		case "":
+			return nil
+		case NamesValidate, NamesSanitize:
+			c.namePolicy = p
+			return nil
+		default:
+			return fmt.Errorf("invalid name policy '%s', must be one of: %s, %s", p, NamesValidate, NamesSanitize)
+		}
+	}
+}
+
+func (c *collectorOptions) apply(opts ...collectorSetting) error {
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewCollector returns a collector which aggregates the versions of several discoverers with the given settings
+func NewCollector(opts ...collectorSetting) (*collector, error) { //nolint:golint,revive
+	o := &collectorOptions{
+		conflictPolicy: ConflictFirstWins,
+		namePolicy:     NamesValidate,
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &collector{
+		opts: *o,
+	}, nil
+}
+
+type collector struct {
+	opts collectorOptions
+}
+
+// Versions returns the json encoded versions of all the discoverers, using the default collector settings
 func Versions(d ...Discoverer) ([]byte, error) {
+	c, err := NewCollector()
+	if err != nil {
+		return nil, err
+	}
+	return c.Versions(d...)
+}
+
+// Versions returns the json encoded versions of all the discoverers, with valid Kubernetes names,
+// de-duplicated by name and sorted by semantic version (descending), then by name.
+// Errors are attached to the discoverer they come from, named by its String method if any.
+func (c *collector) Versions(d ...Discoverer) ([]byte, error) {
 	var err error
-	var versions []*provv1.ManagedOSVersion
-	for _, dd := range d {
+	var found []sourced
+	for i, dd := range d {
+		source := sourceName(dd, i)
 		res, e := dd.Discovery()
 		if e != nil {
-			err = multierror.Append(err, e)
+			err = multierror.Append(err, fmt.Errorf("%s: %w", source, e))
+		}
+		for _, v := range res {
+			found = append(found, sourced{version: v, source: source})
 		}
-		versions = append(versions, res...)
 	}
 
+	versions, e := c.checkNames(found)
+	if e != nil {
+		err = multierror.Append(err, e)
+	}
+
+	versions, e = c.deduplicate(versions)
+	if e != nil {
+		err = multierror.Append(err, e)
+	}
+	sortVersions(versions)
+
 	b, e := json.Marshal(versions)
 	if e != nil {
 		err = multierror.Append(err, e)
@@ -45,3 +156,72 @@ func Versions(d ...Discoverer) ([]byte, error) {
 
 	return b, err
 }
+
+// deduplicate drops the versions with duplicate names according to the conflict policy
+func (c *collector) deduplicate(versions []*provv1.ManagedOSVersion) (res []*provv1.ManagedOSVersion, err error) {
+	seen := map[string]int{}
+	for _, v := range versions {
+		i, ok := seen[v.ObjectMeta.Name]
+		if !ok {
+			seen[v.ObjectMeta.Name] = len(res)
+			res = append(res, v)
+			continue
+		}
+
+		switch c.opts.conflictPolicy {
+		case ConflictLastWins:
+			res[i] = v
+		case ConflictError:
+			err = multierror.Append(err, fmt.Errorf("duplicate version '%s'", v.ObjectMeta.Name))
+		case ConflictMerge:
+			res[i] = mergeMetadata(res[i], v)
+		}
+	}
+	return
+}
+
+// mergeMetadata returns a copy of dst with the metadata keys of src which are missing in dst
+func mergeMetadata(dst, src *provv1.ManagedOSVersion) *provv1.ManagedOSVersion {
+	if src.Spec.Metadata == nil {
+		return dst
+	}
+
+	merged := dst.DeepCopy()
+	if merged.Spec.Metadata == nil {
+		merged.Spec.Metadata = &v1alpha1.GenericMap{Data: map[string]interface{}{}}
+	}
+	if merged.Spec.Metadata.Data == nil {
+		merged.Spec.Metadata.Data = map[string]interface{}{}
+	}
+
+	for k, v := range src.Spec.Metadata.Data {
+		if _, ok := merged.Spec.Metadata.Data[k]; !ok {
+			merged.Spec.Metadata.Data[k] = v
+		}
+	}
+	return merged
+}
+
+// sortVersions sorts versions by semantic version in descending order, then by name.
+// Versions which aren't valid semver are sorted by name after the others.
+func sortVersions(versions []*provv1.ManagedOSVersion) {
+	parsed := map[*provv1.ManagedOSVersion]*semver.Version{}
+	for _, v := range versions {
+		if sv, err := semver.NewVersion(versionOf(v)); err == nil {
+			parsed[v] = sv
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, vj := parsed[versions[i]], parsed[versions[j]]
+		switch {
+		case vi != nil && vj == nil:
+			return true
+		case vi == nil && vj != nil:
+			return false
+		case vi != nil && !vi.Equal(vj):
+			return vi.GreaterThan(vj)
+		}
+		return versions[i].ObjectMeta.Name < versions[j].ObjectMeta.Name
+	})
+}
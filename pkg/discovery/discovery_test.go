@@ -23,10 +23,30 @@ import (
 	. "github.com/onsi/gomega"
 	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
 	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+
+	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	github "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/github"
 )
 
+func withMetadata(name string, data map[string]interface{}) *provv1.ManagedOSVersion {
+	return &provv1.ManagedOSVersion{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Spec: provv1.ManagedOSVersionSpec{
+			Version:  name,
+			Metadata: &v1alpha1.GenericMap{Data: data},
+		},
+	}
+}
+
+func decode(b []byte) []*provv1.ManagedOSVersion {
+	res := []*provv1.ManagedOSVersion{}
+	ExpectWithOffset(1, json.Unmarshal(b, &res)).To(Succeed())
+	return res
+}
+
 var _ = Describe("discovery", func() {
 
 	Context("discovery", func() {
@@ -47,4 +67,109 @@ var _ = Describe("discovery", func() {
 			Expect(res[0].Spec.Metadata.Data).To(HaveKey("upgradeImage"))
 		})
 	})
+
+	Context("collector", func() {
+		first := staticDiscoverer{withMetadata("v0.1.0", map[string]interface{}{"upgradeImage": "first", "foo": "bar"})}
+		second := staticDiscoverer{withMetadata("v0.1.0", map[string]interface{}{"upgradeImage": "second", "baz": "zap"})}
+
+		It("fails with an invalid conflict policy", func() {
+			_, err := NewCollector(WithConflictPolicy("foo"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("sorts versions by semver and name", func() {
+			b, err := Versions(
+				versionsOf("v0.2.0", "latest", "v0.10.0", "v0.2.0-rc1"),
+				versionsOf("v1.0.0", "edge", "v0.9.1"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(decode(b))).To(Equal([]string{"v1.0.0", "v0.10.0", "v0.9.1", "v0.2.0", "v0.2.0-rc1", "edge", "latest"}))
+		})
+
+		It("keeps the first duplicate by default", func() {
+			b, err := Versions(first, second)
+			Expect(err).ToNot(HaveOccurred())
+
+			res := decode(b)
+			Expect(len(res)).To(Equal(1))
+			Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("first"))
+		})
+
+		It("keeps the last duplicate if required", func() {
+			c, err := NewCollector(WithConflictPolicy(ConflictLastWins))
+			Expect(err).ToNot(HaveOccurred())
+
+			b, err := c.Versions(first, second)
+			Expect(err).ToNot(HaveOccurred())
+
+			res := decode(b)
+			Expect(len(res)).To(Equal(1))
+			Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("second"))
+		})
+
+		It("fails on duplicates if required", func() {
+			c, err := NewCollector(WithConflictPolicy(ConflictError))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = c.Versions(first, second)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("v0.1.0"))
+		})
+
+		It("merges the metadata of duplicates if required", func() {
+			c, err := NewCollector(WithConflictPolicy(ConflictMerge))
+			Expect(err).ToNot(HaveOccurred())
+
+			b, err := c.Versions(first, second)
+			Expect(err).ToNot(HaveOccurred())
+
+			res := decode(b)
+			Expect(len(res)).To(Equal(1))
+			Expect(res[0].Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage": "first",
+				"foo":          "bar",
+				"baz":          "zap",
+			}))
+			Expect(first[0].Spec.Metadata.Data).ToNot(HaveKey("baz"))
+		})
+
+		It("reports invalid names with their source", func() {
+			b, err := Versions(
+				versionsOf("v0.1.0"),
+				Named("hotfixes", versionsOf("v0.2.0+build.1", "V0.3.0")),
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("hotfixes: version 'v0.2.0+build.1': invalid name"))
+			Expect(err.Error()).To(ContainSubstring("hotfixes: version 'V0.3.0': invalid name"))
+			Expect(discoverytest.Names(decode(b))).To(Equal([]string{"v0.1.0"}))
+		})
+
+		It("sanitizes invalid names if required", func() {
+			_, err := NewCollector(WithNamePolicy("foo"))
+			Expect(err).To(HaveOccurred())
+
+			c, err := NewCollector(WithNamePolicy(NamesSanitize))
+			Expect(err).ToNot(HaveOccurred())
+
+			invalid := versionsOf("v0.2.0+build.1", "_V0.3.0_")
+			b, err := c.Versions(versionsOf("v0.1.0"), invalid)
+			Expect(err).ToNot(HaveOccurred())
+
+			res := decode(b)
+			Expect(discoverytest.Names(res)).To(Equal([]string{"v0.2.0-build.1", "v0.1.0", "v0.3.0"}))
+			Expect(res[0].Spec.Version).To(Equal("v0.2.0+build.1"))
+			Expect(invalid[0].ObjectMeta.Name).To(Equal("v0.2.0+build.1"))
+		})
+
+		It("fails on sanitized names colliding with other versions", func() {
+			c, err := NewCollector(WithNamePolicy(NamesSanitize))
+			Expect(err).ToNot(HaveOccurred())
+
+			b, err := c.Versions(versionsOf("v0.1.0-rc1"), Named("edge", versionsOf("v0.1.0+rc1", "+++")))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("edge: version 'v0.1.0+rc1': sanitized name 'v0.1.0-rc1' collides with version 'v0.1.0-rc1'"))
+			Expect(err.Error()).To(ContainSubstring("edge: version '+++': invalid name, sanitized to ''"))
+			Expect(discoverytest.Names(decode(b))).To(Equal([]string{"v0.1.0-rc1"}))
+		})
+	})
 })
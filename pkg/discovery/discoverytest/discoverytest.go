@@ -0,0 +1,51 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package discoverytest holds helpers shared by the tests of the discoverers
+package discoverytest
+
+import (
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+)
+
+// Names returns the resource names of the versions, in order
+func Names(versions []*provv1.ManagedOSVersion) []string {
+	names := []string{}
+	for _, v := range versions {
+		names = append(names, v.ObjectMeta.Name)
+	}
+	return names
+}
+
+// Versions returns the spec versions of the versions, in order
+func Versions(versions []*provv1.ManagedOSVersion) []string {
+	res := []string{}
+	for _, v := range versions {
+		res = append(res, v.Spec.Version)
+	}
+	return res
+}
+
+// Discover runs the discovery returned along with an error by a constructor, unless the error is set.
+// It takes the results of the constructor as is, e.g. Discover(NewReleaseFinder(...)).
+func Discover(d interface {
+	Discovery() ([]*provv1.ManagedOSVersion, error)
+}, err error) ([]*provv1.ManagedOSVersion, error) {
+	if err != nil {
+		return nil, err
+	}
+	return d.Discovery()
+}
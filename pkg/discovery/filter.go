@@ -0,0 +1,225 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+)
+
+// NonSemverPolicy defines how the filter handles versions which are not valid semantic versions
+type NonSemverPolicy string
+
+const (
+	// NonSemverKeep keeps non-semver versions untouched, regardless of constraints
+	NonSemverKeep NonSemverPolicy = "keep"
+	// NonSemverSkip drops non-semver versions from the results
+	NonSemverSkip NonSemverPolicy = "skip"
+	// NonSemverFail fails the discovery if a non-semver version is found
+	NonSemverFail NonSemverPolicy = "fail"
+)
+
+type filterOptions struct {
+	constraint *semver.Constraints
+	keepLatest int
+	exclude    *regexp.Regexp
+	nonSemver  NonSemverPolicy
+}
+
+type filterSetting func(f *filterOptions) error
+
+// WithConstraint sets a semver constraint (e.g. ">=v0.2.0 <v1.0.0") versions have to satisfy
+func WithConstraint(s string) filterSetting { //nolint:golint,revive
+	return func(f *filterOptions) error {
+		if s == "" {
+			return nil
+		}
+		c, err := semver.NewConstraint(s)
+		if err != nil {
+			return fmt.Errorf("invalid version constraint '%s': %w", s, err)
+		}
+		f.constraint = c
+		return nil
+	}
+}
+
+// WithKeepLatest keeps only the latest n versions of each minor release. 0 keeps all of them
+func WithKeepLatest(n int) filterSetting { //nolint:golint,revive
+	return func(f *filterOptions) error {
+		if n < 0 {
+			return fmt.Errorf("keep latest can't be negative: %d", n)
+		}
+		f.keepLatest = n
+		return nil
+	}
+}
+
+// WithExclude drops versions matching the given regular expression
+func WithExclude(s string) filterSetting { //nolint:golint,revive
+	return func(f *filterOptions) error {
+		if s == "" {
+			return nil
+		}
+		r, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid exclude expression '%s': %w", s, err)
+		}
+		f.exclude = r
+		return nil
+	}
+}
+
+// WithNonSemverPolicy sets how versions that aren't valid semantic versions are handled
+func WithNonSemverPolicy(p NonSemverPolicy) filterSetting { //nolint:golint,revive
+	return func(f *filterOptions) error {
+		switch p {
+		case "":
+			return nil
+		case NonSemverKeep, NonSemverSkip, NonSemverFail:
+			f.nonSemver = p
+			return nil
+		default:
+			return fmt.Errorf("invalid non-semver policy '%s', must be one of: %s, %s, %s", p, NonSemverKeep, NonSemverSkip, NonSemverFail)
+		}
+	}
+}
+
+func (f *filterOptions) apply(opts ...filterSetting) error {
+	for _, o := range opts {
+		if err := o(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewFilter wraps a Discoverer and filters the versions it returns with the given settings
+func NewFilter(d Discoverer, opts ...filterSetting) (*filter, error) { //nolint:golint,revive
+	o := &filterOptions{
+		nonSemver: NonSemverKeep,
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filter{
+		discoverer: d,
+		opts:       *o,
+	}, nil
+}
+
+type filter struct {
+	discoverer Discoverer
+	opts       filterOptions
+}
+
+// versionOf returns the version string of a ManagedOSVersion, falling back to its name
+func versionOf(v *provv1.ManagedOSVersion) string {
+	if v.Spec.Version != "" {
+		return v.Spec.Version
+	}
+	return v.ObjectMeta.Name
+}
+
+type parsedVersion struct {
+	version *provv1.ManagedOSVersion
+	semver  *semver.Version
+}
+
+// latestPerMinor returns the latest n versions of each minor release
+func latestPerMinor(parsed []parsedVersion, n int) map[*provv1.ManagedOSVersion]bool {
+	minors := map[string][]*semver.Version{}
+	owners := map[*semver.Version]*provv1.ManagedOSVersion{}
+	for _, p := range parsed {
+		if p.semver == nil {
+			continue
+		}
+		minor := fmt.Sprintf("%d.%d", p.semver.Major(), p.semver.Minor())
+		minors[minor] = append(minors[minor], p.semver)
+		owners[p.semver] = p.version
+	}
+
+	latest := map[*provv1.ManagedOSVersion]bool{}
+	for _, vs := range minors {
+		sort.Sort(sort.Reverse(semver.Collection(vs)))
+		for i := 0; i < len(vs) && i < n; i++ {
+			latest[owners[vs[i]]] = true
+		}
+	}
+	return latest
+}
+
+// String describes the filter as its wrapped Discoverer
+func (f *filter) String() string {
+	if s, ok := f.discoverer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return ""
+}
+
+// Discovery retrieves ManagedOSVersion from the wrapped Discoverer, dropping the ones not matching the filter
+func (f *filter) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	versions, err := f.discoverer.Discovery()
+
+	var parsed []parsedVersion
+	for _, v := range versions {
+		s := versionOf(v)
+		if f.opts.exclude != nil && f.opts.exclude.MatchString(s) {
+			continue
+		}
+
+		sv, e := semver.NewVersion(s)
+		if e != nil {
+			switch f.opts.nonSemver {
+			case NonSemverFail:
+				err = multierror.Append(err, fmt.Errorf("'%s' is not a valid semantic version: %w", s, e))
+			case NonSemverKeep:
+				parsed = append(parsed, parsedVersion{version: v})
+			}
+			continue
+		}
+
+		if f.opts.constraint != nil && !f.opts.constraint.Check(sv) {
+			continue
+		}
+		parsed = append(parsed, parsedVersion{version: v, semver: sv})
+	}
+
+	if f.opts.keepLatest == 0 {
+		for _, p := range parsed {
+			res = append(res, p.version)
+		}
+		return
+	}
+
+	latest := latestPerMinor(parsed, f.opts.keepLatest)
+	for _, p := range parsed {
+		if p.semver != nil && !latest[p.version] {
+			continue
+		}
+		res = append(res, p.version)
+	}
+
+	return
+}
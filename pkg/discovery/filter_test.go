@@ -0,0 +1,111 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+)
+
+type staticDiscoverer []*provv1.ManagedOSVersion
+
+func (s staticDiscoverer) Discovery() ([]*provv1.ManagedOSVersion, error) {
+	return s, nil
+}
+
+func versionsOf(versions ...string) staticDiscoverer {
+	res := staticDiscoverer{}
+	for _, v := range versions {
+		res = append(res, &provv1.ManagedOSVersion{
+			ObjectMeta: v1.ObjectMeta{Name: v},
+			Spec:       provv1.ManagedOSVersionSpec{Version: v},
+		})
+	}
+	return res
+}
+
+var _ = Describe("filter", func() {
+	all := versionsOf("v0.1.0", "v0.2.0", "v0.2.1", "v0.2.2", "v0.3.0-rc1", "v1.0.0", "latest")
+
+	Context("settings", func() {
+		It("fails on invalid settings", func() {
+			_, err := NewFilter(all, WithConstraint("not a constraint"))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewFilter(all, WithExclude("("))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewFilter(all, WithKeepLatest(-1))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewFilter(all, WithNonSemverPolicy("foo"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("discovery", func() {
+		It("keeps everything by default", func() {
+			f, err := NewFilter(all)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(Equal(discoverytest.Names(all)))
+		})
+
+		It("applies semver constraints", func() {
+			f, err := NewFilter(all, WithConstraint(">=v0.2.0 <v1.0.0"), WithNonSemverPolicy(NonSemverSkip))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(Equal([]string{"v0.2.0", "v0.2.1", "v0.2.2"}))
+		})
+
+		It("keeps the latest versions of each minor", func() {
+			f, err := NewFilter(all, WithKeepLatest(1))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0", "v0.2.2", "v0.3.0-rc1", "v1.0.0", "latest"}))
+		})
+
+		It("excludes versions matching a regex", func() {
+			f, err := NewFilter(all, WithExclude("-rc"))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).ToNot(ContainElement("v0.3.0-rc1"))
+		})
+
+		It("fails on non-semver versions if required", func() {
+			f, err := NewFilter(all, WithNonSemverPolicy(NonSemverFail))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = f.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("latest"))
+		})
+	})
+})
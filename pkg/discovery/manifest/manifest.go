@@ -0,0 +1,218 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package manifest decodes and validates ManagedOSVersion files, shared by the discoverers reading them
+// from a filesystem or over HTTP
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Parse decodes and validates the ManagedOSVersion of a file, as JSON if its name has a .json extension
+// and as YAML otherwise. Errors refer to the name. The valid versions are returned along with the errors
+// of the invalid ones.
+func Parse(name string, dat []byte) ([]*provv1.ManagedOSVersion, error) {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		return ParseJSON(name, dat)
+	}
+	return ParseYAML(name, dat)
+}
+
+// ParseJSON decodes and validates a JSON document holding a single ManagedOSVersion, an array of them
+// or a List kind with them as items. Decoding errors are located by line and column.
+func ParseJSON(name string, dat []byte) ([]*provv1.ManagedOSVersion, error) {
+	versions, err := decode(dat)
+	if err != nil {
+		return nil, fmt.Errorf("%s%s: %w", name, errorLocation(dat, err), err)
+	}
+	return validateAll(name, versions)
+}
+
+// ParseYAML decodes and validates a YAML stream, each of its documents holding the same content as
+// the JSON ones. Errors refer to the document when the stream has several of them.
+func ParseYAML(name string, dat []byte) ([]*provv1.ManagedOSVersion, error) {
+	docs, err := documents(dat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var res []*provv1.ManagedOSVersion
+	var errs *multierror.Error
+	for i, doc := range docs {
+		docName := name
+		if len(docs) > 1 {
+			docName = fmt.Sprintf("%s: document %d", name, i+1)
+		}
+
+		versions, err := decodeYAML(doc)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", docName, err))
+			continue
+		}
+		versions, err = validateAll(docName, versions)
+		res = append(res, versions...)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return res, errs.ErrorOrNil()
+}
+
+// documents splits a YAML stream in its non empty documents
+func documents(dat []byte) (res [][]byte, err error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(dat)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isEmpty(doc) {
+			continue
+		}
+		res = append(res, doc)
+	}
+}
+
+// isEmpty returns true if a YAML document only holds blank lines and comments
+func isEmpty(doc []byte) bool {
+	for _, l := range strings.Split(string(doc), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && l != "---" && !strings.HasPrefix(l, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// versionKind is the kind of the ManagedOSVersion documents
+const versionKind = "ManagedOSVersion"
+
+// decodeYAML converts a YAML document to JSON before decoding it
+func decodeYAML(doc []byte) ([]*provv1.ManagedOSVersion, error) {
+	dat, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decode(dat)
+}
+
+// decode parses a JSON document holding either a single ManagedOSVersion,
+// an array of them or a List kind with them as items. Documents of other kinds,
+// like the manifests of other tools, hold no version.
+func decode(dat []byte) ([]*provv1.ManagedOSVersion, error) {
+	trimmed := bytes.TrimSpace(dat)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var res []*provv1.ManagedOSVersion
+		err := json.Unmarshal(dat, &res)
+		return res, err
+	}
+
+	var list struct {
+		Kind  string                     `json:"kind"`
+		Items []*provv1.ManagedOSVersion `json:"items"`
+	}
+	if err := json.Unmarshal(dat, &list); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(list.Kind, "List"):
+		return list.Items, nil
+	case list.Kind != "" && list.Kind != versionKind:
+		return nil, nil
+	}
+
+	v := &provv1.ManagedOSVersion{}
+	if err := json.Unmarshal(dat, v); err != nil {
+		return nil, err
+	}
+	return []*provv1.ManagedOSVersion{v}, nil
+}
+
+// errorLocation returns the ":line:column" location of a json decoding error, if known
+func errorLocation(dat []byte, err error) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return ""
+	}
+
+	if offset > int64(len(dat)) {
+		offset = int64(len(dat))
+	}
+	line := 1 + bytes.Count(dat[:offset], []byte("\n"))
+	column := offset - int64(bytes.LastIndexByte(dat[:offset], '\n'))
+	return fmt.Sprintf(":%d:%d", line, column)
+}
+
+// validateAll returns the valid versions, along with the errors of the invalid ones
+func validateAll(name string, versions []*provv1.ManagedOSVersion) (res []*provv1.ManagedOSVersion, err error) {
+	for i, v := range versions {
+		e := Validate(v)
+		if e == nil {
+			res = append(res, v)
+			continue
+		}
+		if len(versions) > 1 {
+			e = fmt.Errorf("item %d: %w", i+1, e)
+		}
+		err = multierror.Append(err, fmt.Errorf("%s: %w", name, e))
+	}
+	return
+}
+
+// Validate checks the ManagedOSVersion has the required fields
+func Validate(v *provv1.ManagedOSVersion) error {
+	if v == nil {
+		return errors.New("empty version")
+	}
+
+	var missing []string
+	if v.ObjectMeta.Name == "" {
+		missing = append(missing, "metadata.name")
+	}
+	if v.Spec.Version == "" {
+		missing = append(missing, "spec.version")
+	}
+	if v.Spec.Type == "" {
+		missing = append(missing, "spec.type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/manifest"
+)
+
+var _ = Describe("manifest", func() {
+	It("parses JSON arrays and lists", func() {
+		res, err := Parse("index.json", []byte(`[
+  {"metadata": {"name": "v0.1.0"}, "spec": {"version": "v0.1.0", "type": "container"}},
+  {"metadata": {"name": "v0.2.0"}, "spec": {"version": "v0.2.0", "type": "container"}}
+]`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0", "v0.2.0"}))
+
+		res, err = ParseJSON("index", []byte(`{"kind": "List", "items": [{"metadata": {"name": "v0.1.0"}, "spec": {"version": "v0.1.0", "type": "iso"}}]}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0"}))
+	})
+
+	It("parses YAML streams, reporting invalid documents", func() {
+		res, err := Parse("index.yaml", []byte(`
+metadata:
+  name: v0.1.0
+spec:
+  version: v0.1.0
+  type: container
+---
+# comments only
+---
+metadata:
+  name: v0.2.0
+spec:
+  type: container
+`))
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0"}))
+		Expect(err).To(MatchError(ContainSubstring("index.yaml: document 2: missing required fields: spec.version")))
+	})
+
+	It("ignores documents of other kinds", func() {
+		res, err := Parse("index.yaml", []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: os2
+---
+kind: ManagedOSVersion
+metadata:
+  name: v0.1.0
+spec:
+  version: v0.1.0
+  type: container
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0"}))
+	})
+
+	It("locates JSON errors", func() {
+		_, err := ParseJSON("index.json", []byte("[\n  {\"metadata\": }\n]"))
+		Expect(err).To(MatchError(ContainSubstring("index.json:2:17: ")))
+	})
+})
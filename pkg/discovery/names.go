@@ -0,0 +1,119 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NamePolicy defines how versions whose name isn't a valid Kubernetes object name are handled
+type NamePolicy string
+
+const (
+	// NamesValidate drops the versions with invalid names and reports an error for them
+	NamesValidate NamePolicy = "validate"
+	// NamesSanitize replaces the invalid characters of the names, reporting an error for the names
+	// which can't be fixed or which collide with another version once sanitized
+	NamesSanitize NamePolicy = "sanitize"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// Sanitize turns a string into a valid Kubernetes object name: lower case alphanumeric characters, '-' or '.',
+// starting and ending with an alphanumeric character. Other characters are replaced by '-'.
+func Sanitize(s string) string {
+	s = invalidNameChars.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > validation.DNS1123SubdomainMaxLength {
+		s = s[:validation.DNS1123SubdomainMaxLength]
+	}
+	return strings.Trim(s, "-.")
+}
+
+// Named returns the discoverer, identified by name in the collector errors
+func Named(name string, d Discoverer) Discoverer {
+	return &named{Discoverer: d, name: name}
+}
+
+type named struct {
+	Discoverer
+	name string
+}
+
+func (n *named) String() string {
+	return n.name
+}
+
+// sourceName identifies a discoverer in errors, by its description if it implements fmt.Stringer
+func sourceName(d Discoverer, i int) string {
+	if s, ok := d.(fmt.Stringer); ok && s.String() != "" {
+		return s.String()
+	}
+	return fmt.Sprintf("source #%d", i)
+}
+
+// sourced is a version along with the discoverer it comes from
+type sourced struct {
+	version *provv1.ManagedOSVersion
+	source  string
+}
+
+// checkNames drops the versions whose name isn't a valid Kubernetes object name, or sanitizes them
+// according to the name policy. Errors refer to the source of the versions.
+func (c *collector) checkNames(versions []sourced) (res []*provv1.ManagedOSVersion, err error) {
+	// sanitized names are checked against all the valid names, wherever they are found
+	owners := map[string]string{}
+	for _, s := range versions {
+		if name := s.version.ObjectMeta.Name; len(validation.IsDNS1123Subdomain(name)) == 0 {
+			owners[name] = name
+		}
+	}
+
+	for _, s := range versions {
+		name := s.version.ObjectMeta.Name
+		errs := validation.IsDNS1123Subdomain(name)
+		if len(errs) == 0 {
+			res = append(res, s.version)
+			continue
+		}
+		if c.opts.namePolicy != NamesSanitize {
+			err = multierror.Append(err, fmt.Errorf("%s: version '%s': invalid name: %s", s.source, name, strings.Join(errs, ", ")))
+			continue
+		}
+
+		fixed := Sanitize(name)
+		if errs := validation.IsDNS1123Subdomain(fixed); len(errs) > 0 {
+			err = multierror.Append(err, fmt.Errorf("%s: version '%s': invalid name, sanitized to '%s': %s", s.source, name, fixed, strings.Join(errs, ", ")))
+			continue
+		}
+		if owner, ok := owners[fixed]; ok && owner != name {
+			err = multierror.Append(err, fmt.Errorf("%s: version '%s': sanitized name '%s' collides with version '%s'", s.source, name, fixed, owner))
+			continue
+		}
+		owners[fixed] = name
+
+		v := s.version.DeepCopy()
+		v.ObjectMeta.Name = fixed
+		res = append(res, v)
+	}
+	return
+}
@@ -0,0 +1,301 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+)
+
+// ForgeRelease is a release listed by the API of a forge, with the release data added to the version metadata
+type ForgeRelease struct {
+	Tag        string
+	Name       string
+	Prerelease bool
+	Draft      bool
+	Data       map[string]interface{}
+}
+
+// Forge lists the releases of a repository through the API of a forge, e.g. GitLab or Gitea
+type Forge interface {
+	// Releases returns the releases of the repository, up to the max releases of the options if set
+	Releases(o ForgeOptions) ([]ForgeRelease, error)
+}
+
+// ForgeOptions holds the settings of a forge release finder
+type ForgeOptions struct {
+	Ctx                context.Context
+	Repository         string
+	BaseURL            string
+	Token              string
+	MaxReleases        int
+	naming             Naming
+	includePreReleases bool
+	includeDrafts      bool
+	digestPinning      bool
+	missingImages      MissingImagePolicy
+	registryUsername   string
+	registryPassword   string
+	registryToken      string
+	registryPlainHTTP  bool
+}
+
+// ForgeSetting is a setting of a forge release finder
+type ForgeSetting func(o *ForgeOptions) error
+
+// WithRepository sets the repository to scan releases against, in the format of the forge
+func WithRepository(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.Repository = s
+		return nil
+	}
+}
+
+// WithContext sets a context for the discovery action
+func WithContext(ctx context.Context) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.Ctx = ctx
+		return nil
+	}
+}
+
+// WithToken sets an access token to use for auth requests
+func WithToken(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.Token = s
+		return nil
+	}
+}
+
+// WithBaseURL sets the URL of the forge instance, e.g. https://gitea.example.com
+func WithBaseURL(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		if s == "" {
+			return nil
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid base URL '%s'", s)
+		}
+		o.BaseURL = strings.TrimSuffix(s, "/")
+		return nil
+	}
+}
+
+// WithBaseImage sets the image repository the versions are appended to as a tag
+func WithBaseImage(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.naming.BaseImage = s
+		return nil
+	}
+}
+
+// WithVersionNamePrefix adds a prefix to the created ManagedOSVersion resource
+func WithVersionNamePrefix(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.naming.NamePrefix = s
+		return nil
+	}
+}
+
+// WithVersionNameSuffix appends a suffix to the created ManagedOSVersion resource
+func WithVersionNameSuffix(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.naming.NameSuffix = s
+		return nil
+	}
+}
+
+// WithVersionPrefix adds a prefix to the retrieved version
+func WithVersionPrefix(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.naming.VersionPrefix = s
+		return nil
+	}
+}
+
+// WithVersionSuffix appends a suffix to the retrieved version
+func WithVersionSuffix(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.naming.VersionSuffix = s
+		return nil
+	}
+}
+
+// WithPreReleases includes the pre-releases in the releases list
+func WithPreReleases(value bool) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.includePreReleases = value
+		return nil
+	}
+}
+
+// WithDrafts includes the draft releases in the releases list
+func WithDrafts(value bool) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.includeDrafts = value
+		return nil
+	}
+}
+
+// WithMaxReleases caps the number of releases retrieved from the forge API.
+// A value of 0 (the default) walks all the available pages.
+func WithMaxReleases(n int) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		if n < 0 {
+			return fmt.Errorf("max releases can't be negative: %d", n)
+		}
+		o.MaxReleases = n
+		return nil
+	}
+}
+
+// WithDigestPinning resolves the upgrade images against the registry and pins them to their digest
+func WithDigestPinning(value bool) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.digestPinning = value
+		return nil
+	}
+}
+
+// WithMissingImagePolicy sets how versions whose upgrade image doesn't exist are handled when pinning digests
+func WithMissingImagePolicy(p MissingImagePolicy) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		if p == "" {
+			return nil
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		o.missingImages = p
+		return nil
+	}
+}
+
+// WithRegistryAuth sets the credentials used against the registry when pinning digests
+func WithRegistryAuth(username, password string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.registryUsername = username
+		o.registryPassword = password
+		return nil
+	}
+}
+
+// WithRegistryToken sets a bearer token used against the registry when pinning digests
+func WithRegistryToken(s string) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.registryToken = s
+		return nil
+	}
+}
+
+// WithRegistryPlainHTTP talks to the registry over plain HTTP when pinning digests
+func WithRegistryPlainHTTP(value bool) ForgeSetting {
+	return func(o *ForgeOptions) error {
+		o.registryPlainHTTP = value
+		return nil
+	}
+}
+
+func (o *ForgeOptions) apply(opts ...ForgeSetting) error {
+	for _, s := range opts {
+		if err := s(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForgeFinder discovers a container ManagedOSVersion for each release listed by a forge
+type ForgeFinder struct {
+	kind     string
+	forge    Forge
+	registry *oci.Client
+	opts     ForgeOptions
+}
+
+// NewForgeFinder returns a release finder listing the releases with the forge, identified by its kind
+// in the discovery errors and the metadata key of the release data. The base URL is used unless one is set.
+func NewForgeFinder(kind string, forge Forge, baseURL string, opts ...ForgeSetting) (*ForgeFinder, error) {
+	o := &ForgeOptions{
+		Ctx:           context.Background(),
+		BaseURL:       baseURL,
+		missingImages: MissingImageDrop,
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	o.naming.Repository = o.Repository
+
+	reg, err := oci.NewClient(
+		oci.WithContext(o.Ctx),
+		oci.WithBasicAuth(o.registryUsername, o.registryPassword),
+		oci.WithToken(o.registryToken),
+		oci.WithPlainHTTP(o.registryPlainHTTP),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForgeFinder{
+		kind:     kind,
+		forge:    forge,
+		registry: reg,
+		opts:     *o,
+	}, nil
+}
+
+// String identifies the finder in the discovery errors
+func (f *ForgeFinder) String() string {
+	return f.kind + ":" + f.opts.Repository
+}
+
+// Discovery retrieves ManagedOSVersion from the forge releases
+func (f *ForgeFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	rels, err := f.forge.Releases(f.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rels {
+		// skip pre-releases and drafts unless we explicitly include them
+		if r.Prerelease && !f.opts.includePreReleases {
+			continue
+		}
+		if r.Draft && !f.opts.includeDrafts {
+			continue
+		}
+
+		v, err := f.opts.naming.ContainerVersion(r.Tag, r.Name, map[string]interface{}{f.kind + "_data": r.Data})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+
+	if !f.opts.digestPinning {
+		return
+	}
+	return PinDigests(f.registry, res, f.opts.missingImages)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetadataProfile defines which release data is added to the ManagedOSVersion metadata
+type MetadataProfile string
+
+const (
+	// MetadataFull adds the whole release data as returned by the API
+	MetadataFull MetadataProfile = "full"
+	// MetadataCurated adds a stable set of keys: tag, release URL, published date, prerelease flag and commit SHA
+	MetadataCurated MetadataProfile = "curated"
+	// MetadataNone adds no release data
+	MetadataNone MetadataProfile = "none"
+)
+
+// Validate returns an error if the profile is unknown
+func (p MetadataProfile) Validate() error {
+	switch p {
+	case MetadataFull, MetadataCurated, MetadataNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid metadata profile '%s', must be one of: %s, %s, %s", p, MetadataFull, MetadataCurated, MetadataNone)
+	}
+}
+
+var (
+	selectorPath = regexp.MustCompile(`^(\.|(\.[^.\[\]]+|\[\d+\])+)$`)
+	selectorStep = regexp.MustCompile(`\.([^.\[\]]+)|\[(\d+)\]`)
+)
+
+// Selector picks a field of the release data to add to the metadata under a key
+type Selector struct {
+	Key  string
+	Path string
+}
+
+// ParseSelector parses a "key=.path" selector, where the path is made of .field and [index] steps, e.g. author=.author.login
+func ParseSelector(s string) (Selector, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || !selectorPath.MatchString(s[i+1:]) {
+		return Selector{}, fmt.Errorf("invalid metadata selector '%s', must be like key=.field[0].field", s)
+	}
+	return Selector{Key: s[:i], Path: s[i+1:]}, nil
+}
+
+// Select returns the value at the selector path of some decoded JSON data, and whether it exists
+func (s Selector) Select(data interface{}) (interface{}, bool) {
+	for _, m := range selectorStep.FindAllStringSubmatch(s.Path, -1) {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			if m[1] == "" {
+				return nil, false
+			}
+			val, ok := v[m[1]]
+			if !ok {
+				return nil, false
+			}
+			data = val
+		case []interface{}:
+			i, err := strconv.Atoi(m[2])
+			if m[2] == "" || err != nil || i >= len(v) {
+				return nil, false
+			}
+			data = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// SelectMetadata returns the fields of the JSON representation of obj picked by the selectors,
+// selectors whose path doesn't exist are skipped
+func SelectMetadata(obj interface{}, selectors []Selector) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	if len(selectors) == 0 {
+		return res, nil
+	}
+
+	dat, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(dat, &data); err != nil {
+		return nil, err
+	}
+
+	for _, s := range selectors {
+		if v, ok := s.Select(data); ok {
+			res[s.Key] = v
+		}
+	}
+	return res, nil
+}
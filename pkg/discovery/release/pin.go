@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+// MissingImagePolicy defines how versions whose upgrade image doesn't exist are handled when pinning digests
+type MissingImagePolicy string
+
+const (
+	// MissingImageDrop drops the versions with missing images, logging a warning
+	MissingImageDrop MissingImagePolicy = "drop"
+	// MissingImageFail drops the versions with missing images and fails the discovery
+	MissingImageFail MissingImagePolicy = "fail"
+)
+
+// Validate returns an error if the policy is unknown
+func (p MissingImagePolicy) Validate() error {
+	switch p {
+	case MissingImageDrop, MissingImageFail:
+		return nil
+	default:
+		return fmt.Errorf("invalid missing image policy '%s', must be one of: %s, %s", p, MissingImageDrop, MissingImageFail)
+	}
+}
+
+// PinDigests replaces the tag of the upgradeImage of the versions with the digest it points to,
+// keeping the tagged image in the upgradeImageTag metadata field
+func PinDigests(c *oci.Client, versions []*provv1.ManagedOSVersion, policy MissingImagePolicy) (res []*provv1.ManagedOSVersion, err error) {
+	for _, v := range versions {
+		if v.Spec.Metadata == nil {
+			res = append(res, v)
+			continue
+		}
+		image, ok := v.Spec.Metadata.Data["upgradeImage"].(string)
+		if !ok || image == "" {
+			res = append(res, v)
+			continue
+		}
+
+		ref, tag, e := oci.ParseImage(image)
+		if e != nil {
+			err = multierror.Append(err, fmt.Errorf("version '%s': %w", v.ObjectMeta.Name, e))
+			continue
+		}
+
+		digest, e := c.Digest(ref, tag)
+		switch {
+		case errors.Is(e, oci.ErrNotFound) && policy == MissingImageDrop:
+			logrus.Warnf("Image '%s' of version '%s' not found, skipping", image, v.ObjectMeta.Name)
+			continue
+		case e != nil:
+			err = multierror.Append(err, fmt.Errorf("version '%s': %w", v.ObjectMeta.Name, e))
+			continue
+		}
+
+		v.Spec.Metadata.Data["upgradeImageTag"] = image
+		v.Spec.Metadata.Data["upgradeImage"] = fmt.Sprintf("%s@%s", strings.TrimSuffix(image, ":"+tag), digest)
+		res = append(res, v)
+	}
+	return
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ContainerType is the ManagedOSVersion type of container based upgrades
+const ContainerType = "container"
+
+// Naming holds the settings used to build ManagedOSVersion from release tags
+type Naming struct {
+	// VersionPrefix and VersionSuffix are added to the tag to build the version
+	VersionPrefix string
+	VersionSuffix string
+	// NamePrefix and NameSuffix are added to the version to build the resource name
+	NamePrefix string
+	NameSuffix string
+	// BaseImage is the image repository the version is appended to as a tag
+	BaseImage string
+	// Repository is the repository the releases come from, available to the templates
+	Repository string
+
+	versionTemplate *template.Template
+	nameTemplate    *template.Template
+	imageTemplate   *template.Template
+}
+
+// Version returns the version for a release tag
+func (n Naming) Version(tag string) string {
+	return strings.Join([]string{n.VersionPrefix, tag, n.VersionSuffix}, "")
+}
+
+// Name returns the resource name for a version
+func (n Naming) Name(version string) string {
+	return strings.Join([]string{n.NamePrefix, version, n.NameSuffix}, "")
+}
+
+// Image returns the upgrade image for a version
+func (n Naming) Image(version string) string {
+	return fmt.Sprintf("%s:%s", n.BaseImage, version)
+}
+
+// names returns the version, resource name and upgrade image of a release, described by its template data
+func (n Naming) names(d TemplateData) (version, name, image string, err error) {
+	version = n.Version(d.Tag)
+	if n.versionTemplate != nil {
+		if version, err = render(n.versionTemplate, d); err != nil {
+			return
+		}
+	}
+	d.Version = version
+
+	name = n.Name(version)
+	if n.nameTemplate != nil {
+		if name, err = render(n.nameTemplate, d); err != nil {
+			return
+		}
+		name = discovery.Sanitize(name)
+	}
+
+	image = n.Image(version)
+	if n.imageTemplate != nil {
+		image, err = render(n.imageTemplate, d)
+	}
+	return
+}
+
+// ContainerVersion returns a container ManagedOSVersion for a release tag, with the given additional metadata.
+// The release name is only used by the templates, it defaults to the tag.
+func (n Naming) ContainerVersion(tag, releaseName string, metadata map[string]interface{}) (*provv1.ManagedOSVersion, error) {
+	v, name, image, err := n.names(newTemplateData(tag, releaseName, n.Repository))
+	if err != nil {
+		return nil, fmt.Errorf("tag '%s': %w", tag, err)
+	}
+
+	data := map[string]interface{}{}
+	for k, val := range metadata {
+		data[k] = val
+	}
+	data["upgradeImage"] = image
+
+	return newVersion(name, v, ContainerType, data), nil
+}
+
+// AssetVersion returns a ManagedOSVersion of the given type for an asset of a release, with the given additional
+// metadata. Unless a name template is set, the sanitized asset name is appended to the resource name so the
+// assets of a release get different names. Container versions get an upgrade image, as the ones of ContainerVersion.
+func (n Naming) AssetVersion(tag, releaseName, asset, versionType string, metadata map[string]interface{}) (*provv1.ManagedOSVersion, error) {
+	d := newTemplateData(tag, releaseName, n.Repository)
+	d.Asset = asset
+	v, name, image, err := n.names(d)
+	if err != nil {
+		return nil, fmt.Errorf("tag '%s', asset '%s': %w", tag, asset, err)
+	}
+	if n.nameTemplate == nil {
+		name = strings.Join([]string{name, discovery.Sanitize(asset)}, "-")
+	}
+
+	data := map[string]interface{}{}
+	for k, val := range metadata {
+		data[k] = val
+	}
+	if versionType == ContainerType {
+		data["upgradeImage"] = image
+	}
+
+	return newVersion(name, v, versionType, data), nil
+}
+
+// ChartVersion returns a container ManagedOSVersion for a version of a Helm chart, with the given additional
+// metadata. The chart version is used as tag, and unless an image template is set the upgrade image is the
+// base image tagged with the app version of the chart.
+func (n Naming) ChartVersion(chartVersion, appVersion string, metadata map[string]interface{}) (*provv1.ManagedOSVersion, error) {
+	d := newTemplateData(chartVersion, "", n.Repository)
+	d.AppVersion = appVersion
+	v, name, image, err := n.names(d)
+	if err != nil {
+		return nil, fmt.Errorf("chart version '%s': %w", chartVersion, err)
+	}
+	if n.imageTemplate == nil {
+		if appVersion == "" {
+			return nil, fmt.Errorf("chart version '%s': no appVersion set", chartVersion)
+		}
+		image = n.Image(appVersion)
+	}
+
+	data := map[string]interface{}{}
+	for k, val := range metadata {
+		data[k] = val
+	}
+	data["upgradeImage"] = image
+
+	return newVersion(name, v, ContainerType, data), nil
+}
+
+func newVersion(name, version, versionType string, data map[string]interface{}) *provv1.ManagedOSVersion {
+	return &provv1.ManagedOSVersion{
+		ObjectMeta: v1.ObjectMeta{
+			Name: name,
+		},
+		Spec: provv1.ManagedOSVersionSpec{
+			Type:    versionType,
+			Version: version,
+			Metadata: &v1alpha1.GenericMap{
+				Data: data,
+			},
+		},
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci/ocitest"
+)
+
+var _ = Describe("release", func() {
+	Context("naming", func() {
+		It("builds container versions", func() {
+			n := Naming{
+				VersionPrefix: "foo",
+				VersionSuffix: "bar",
+				NamePrefix:    "zap",
+				NameSuffix:    "zof",
+				BaseImage:     "quay.io/costoolkit/os2",
+			}
+
+			v, err := n.ContainerVersion("v0.1.0", "", map[string]interface{}{"foo": "bar"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.ObjectMeta.Name).To(Equal("zapfoov0.1.0barzof"))
+			Expect(v.Spec.Version).To(Equal("foov0.1.0bar"))
+			Expect(v.Spec.Type).To(Equal(ContainerType))
+			Expect(v.Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage": "quay.io/costoolkit/os2:foov0.1.0bar",
+				"foo":          "bar",
+			}))
+		})
+
+		It("builds chart versions from their app version", func() {
+			n := Naming{NamePrefix: "os-", BaseImage: "quay.io/costoolkit/os2"}
+
+			v, err := n.ChartVersion("1.2.0", "v0.5.0", map[string]interface{}{"chart": "os2"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.ObjectMeta.Name).To(Equal("os-1.2.0"))
+			Expect(v.Spec.Version).To(Equal("1.2.0"))
+			Expect(v.Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage": "quay.io/costoolkit/os2:v0.5.0",
+				"chart":        "os2",
+			}))
+
+			_, err = n.ChartVersion("1.3.0", "", nil)
+			Expect(err).To(HaveOccurred())
+
+			Expect(n.SetImageTemplate(`registry/os2:{{.AppVersion | trimPrefix "v"}}-{{.Major}}`)).To(Succeed())
+			v, err = n.ChartVersion("1.2.0", "v0.5.0", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.Spec.Metadata.Data["upgradeImage"]).To(Equal("registry/os2:0.5.0-1"))
+		})
+	})
+
+	Context("templates", func() {
+		It("renders versions, names and images", func() {
+			n := Naming{Repository: "rancher-sandbox/os2", NamePrefix: "ignored"}
+			Expect(n.SetVersionTemplate(`{{.Tag | trimPrefix "v"}}`)).To(Succeed())
+			Expect(n.SetNameTemplate(`{{.Repository}}-{{.ReleaseName}}`)).To(Succeed())
+			Expect(n.SetImageTemplate(`registry/os-{{.Major}}.{{.Minor}}:{{.Version}}{{if .Prerelease}}-pre{{end}}`)).To(Succeed())
+
+			v, err := n.ContainerVersion("v1.2.3-rc1", "Release 1.2.3_RC1", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.Spec.Version).To(Equal("1.2.3-rc1"))
+			Expect(v.ObjectMeta.Name).To(Equal("rancher-sandbox-os2-release-1.2.3-rc1"))
+			Expect(v.Spec.Metadata.Data["upgradeImage"]).To(Equal("registry/os-1.2:1.2.3-rc1-pre"))
+
+			v, err = n.ContainerVersion("latest", "", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(v.ObjectMeta.Name).To(Equal("rancher-sandbox-os2-latest"))
+			Expect(v.Spec.Metadata.Data["upgradeImage"]).To(Equal("registry/os-0.0:latest"))
+		})
+
+		It("fails on invalid templates", func() {
+			n := Naming{}
+			Expect(n.SetNameTemplate("{{.Tag")).ToNot(Succeed())
+			Expect(n.SetNameTemplate("{{.Foo}}")).To(Succeed())
+			_, err := n.ContainerVersion("v0.1.0", "", nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("metadata", func() {
+		It("selects fields of the release data", func() {
+			rel := map[string]interface{}{
+				"tag_name": "v0.1.0",
+				"author":   map[string]interface{}{"login": "foo"},
+				"assets": []interface{}{
+					map[string]interface{}{"name": "os.iso"},
+				},
+			}
+
+			var selectors []Selector
+			for _, s := range []string{"tag=.tag_name", "author=.author.login", "iso=.assets[0].name", "missing=.assets[1].name", "all=."} {
+				sel, err := ParseSelector(s)
+				Expect(err).ToNot(HaveOccurred())
+				selectors = append(selectors, sel)
+			}
+
+			res, err := SelectMetadata(rel, selectors)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(4))
+			Expect(res["tag"]).To(Equal("v0.1.0"))
+			Expect(res["author"]).To(Equal("foo"))
+			Expect(res["iso"]).To(Equal("os.iso"))
+			Expect(res["all"]).To(HaveKey("tag_name"))
+		})
+
+		It("rejects invalid selectors and profiles", func() {
+			for _, s := range []string{"tag", "=.tag", "tag=tag_name", "tag=.tag[a]", "tag=.tag..name"} {
+				_, err := ParseSelector(s)
+				Expect(err).To(HaveOccurred(), s)
+			}
+			Expect(MetadataProfile("foo").Validate()).ToNot(Succeed())
+			Expect(MetadataCurated.Validate()).To(Succeed())
+		})
+	})
+
+	Context("digest pinning", func() {
+		var reg *ocitest.Registry
+		var cli *oci.Client
+		var versions []*provv1.ManagedOSVersion
+		var digest string
+
+		BeforeEach(func() {
+			reg = ocitest.NewRegistry()
+			digest = reg.Push("costoolkit/os2", "v0.1.0")
+
+			var err error
+			cli, err = oci.NewClient(oci.WithPlainHTTP(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			n := Naming{BaseImage: reg.Host() + "/costoolkit/os2"}
+			versions = nil
+			for _, t := range []string{"v0.1.0", "v0.2.0"} {
+				v, err := n.ContainerVersion(t, "", nil)
+				Expect(err).ToNot(HaveOccurred())
+				versions = append(versions, v)
+			}
+		})
+
+		AfterEach(func() {
+			reg.Close()
+		})
+
+		It("validates policies", func() {
+			Expect(MissingImageDrop.Validate()).To(Succeed())
+			Expect(MissingImageFail.Validate()).To(Succeed())
+			Expect(MissingImagePolicy("foo").Validate()).ToNot(Succeed())
+		})
+
+		It("pins digests and drops missing images", func() {
+			res, err := PinDigests(cli, versions, MissingImageDrop)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(1))
+			Expect(res[0].Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage":    reg.Host() + "/costoolkit/os2@" + digest,
+				"upgradeImageTag": reg.Host() + "/costoolkit/os2:v0.1.0",
+			}))
+		})
+
+		It("fails on missing images if required", func() {
+			res, err := PinDigests(cli, versions, MissingImageFail)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("v0.2.0"))
+			Expect(len(res)).To(Equal(1))
+		})
+	})
+
+	Context("forges", func() {
+		var forge *fakeForge
+
+		BeforeEach(func() {
+			forge = &fakeForge{releases: []ForgeRelease{
+				{Tag: "v0.3.0", Draft: true},
+				{Tag: "v0.2.0", Prerelease: true},
+				{Tag: "v0.1.0", Name: "first", Data: map[string]interface{}{"name": "first"}},
+			}}
+		})
+
+		It("builds container versions from the releases", func() {
+			f, err := NewForgeFinder("fake", forge, "https://forge.example.com", WithRepository("os/os2"), WithBaseImage("registry.example.com/os2"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.String()).To(Equal("fake:os/os2"))
+
+			res, err := f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(res[0].Spec.Version).To(Equal("v0.1.0"))
+			Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("registry.example.com/os2:v0.1.0"))
+			Expect(res[0].Spec.Metadata.Data["fake_data"]).To(HaveKeyWithValue("name", "first"))
+			Expect(forge.opts.BaseURL).To(Equal("https://forge.example.com"))
+
+			f, err = NewForgeFinder("fake", forge, "", WithPreReleases(true), WithDrafts(true), WithBaseURL("http://forge.local/"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err = f.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(3))
+			Expect(forge.opts.BaseURL).To(Equal("http://forge.local"))
+		})
+
+		It("rejects invalid settings", func() {
+			_, err := NewForgeFinder("fake", forge, "", WithBaseURL("forge.local"))
+			Expect(err).To(HaveOccurred())
+			_, err = NewForgeFinder("fake", forge, "", WithMaxReleases(-1))
+			Expect(err).To(HaveOccurred())
+			_, err = NewForgeFinder("fake", forge, "", WithMissingImagePolicy("foo"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+// fakeForge lists fixed releases, keeping the options it was called with
+type fakeForge struct {
+	releases []ForgeRelease
+	opts     ForgeOptions
+}
+
+func (f *fakeForge) Releases(o ForgeOptions) ([]ForgeRelease, error) {
+	f.opts = o
+	return f.releases, nil
+}
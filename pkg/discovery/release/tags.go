@@ -0,0 +1,68 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// TagFilter selects release tags by regular expression and semver constraint, its zero value matches any tag
+type TagFilter struct {
+	Pattern    *regexp.Regexp
+	Constraint *semver.Constraints
+}
+
+// SetPattern only matches the tags matching the given regular expression, an empty one matches any tag
+func (t *TagFilter) SetPattern(s string) error {
+	if s == "" {
+		return nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return fmt.Errorf("invalid tag pattern '%s': %w", s, err)
+	}
+	t.Pattern = re
+	return nil
+}
+
+// SetConstraint only matches the semver tags satisfying the given constraint, an empty one matches any tag
+func (t *TagFilter) SetConstraint(s string) error {
+	if s == "" {
+		return nil
+	}
+	c, err := semver.NewConstraint(s)
+	if err != nil {
+		return fmt.Errorf("invalid tag constraint '%s': %w", s, err)
+	}
+	t.Constraint = c
+	return nil
+}
+
+// Matches returns true if the tag satisfies the pattern and constraint
+func (t TagFilter) Matches(tag string) bool {
+	if t.Pattern != nil && !t.Pattern.MatchString(tag) {
+		return false
+	}
+	if t.Constraint == nil {
+		return true
+	}
+	v, err := semver.NewVersion(tag)
+	return err == nil && t.Constraint.Check(v)
+}
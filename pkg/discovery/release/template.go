@@ -0,0 +1,109 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package release
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+)
+
+// TemplateData is the data the naming templates are rendered with
+type TemplateData struct {
+	// Tag is the release tag
+	Tag string
+	// Major, Minor, Patch and Prerelease are the parts of the tag if it's a semantic version, empty otherwise
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease string
+	// ReleaseName is the name of the release, or the tag if the source has no release names
+	ReleaseName string
+	// Repository is the repository the release comes from
+	Repository string
+	// Version is the rendered version, set for the name and image templates
+	Version string
+	// Asset is the name of the release asset the version is built from, if any
+	Asset string
+	// AppVersion is the app version of the Helm chart the version is built from, if any
+	AppVersion string
+}
+
+func newTemplateData(tag, releaseName, repository string) TemplateData {
+	d := TemplateData{
+		Tag:         tag,
+		ReleaseName: releaseName,
+		Repository:  repository,
+	}
+	if d.ReleaseName == "" {
+		d.ReleaseName = tag
+	}
+	if v, err := semver.NewVersion(tag); err == nil {
+		d.Major, d.Minor, d.Patch, d.Prerelease = v.Major(), v.Minor(), v.Patch(), v.Prerelease()
+	}
+	return d
+}
+
+var templateFuncs = template.FuncMap{
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"sanitize":   discovery.Sanitize,
+}
+
+func parseTemplate(name, s string) (*template.Template, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func render(t *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SetVersionTemplate renders the versions with a template instead of adding the version prefix and suffix to the tag
+func (n *Naming) SetVersionTemplate(s string) (err error) {
+	n.versionTemplate, err = parseTemplate("version", s)
+	return
+}
+
+// SetNameTemplate renders the resource names with a template instead of adding the name prefix and suffix
+// to the version. The rendered names are sanitized to be valid Kubernetes object names.
+func (n *Naming) SetNameTemplate(s string) (err error) {
+	n.nameTemplate, err = parseTemplate("name", s)
+	return
+}
+
+// SetImageTemplate renders the upgrade images with a template instead of tagging the base image with the version
+func (n *Naming) SetImageTemplate(s string) (err error) {
+	n.imageTemplate, err = parseTemplate("image", s)
+	return
+}
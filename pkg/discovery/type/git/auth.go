@@ -0,0 +1,77 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// auth returns the authentication method matching the settings, nil if none is required
+func (g *gitOptions) auth() (transport.AuthMethod, error) {
+	hasSSHKey := len(g.sshKey) > 0 || g.sshKeyFile != ""
+
+	switch {
+	case hasSSHKey && (g.password != "" || g.token != ""):
+		return nil, fmt.Errorf("basic auth and SSH key authentication are mutually exclusive")
+	case len(g.sshKey) > 0 && g.sshKeyFile != "":
+		return nil, fmt.Errorf("SSH key and SSH key file are mutually exclusive")
+	case g.password != "" && g.token != "":
+		return nil, fmt.Errorf("basic auth password and token are mutually exclusive")
+	case g.username != "" && g.password == "" && g.token == "":
+		return nil, fmt.Errorf("basic auth username '%s' set without a password or token", g.username)
+	case g.token != "":
+		username := g.username
+		if username == "" {
+			// Most git servers accept tokens as password of any non empty user
+			username = "git"
+		}
+		return &http.BasicAuth{Username: username, Password: g.token}, nil
+	case g.password != "":
+		return &http.BasicAuth{Username: g.username, Password: g.password}, nil
+	case !hasSSHKey:
+		return nil, nil
+	}
+
+	var keys *ssh.PublicKeys
+	var err error
+	if g.sshKeyFile != "" {
+		keys, err = ssh.NewPublicKeysFromFile(g.sshUser, g.sshKeyFile, g.sshKeyPassphrase)
+	} else {
+		keys, err = ssh.NewPublicKeys(g.sshUser, g.sshKey, g.sshKeyPassphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH key: %w", err)
+	}
+
+	switch {
+	case g.insecureIgnoreHostKey:
+		keys.HostKeyCallback = gossh.InsecureIgnoreHostKey() //nolint:gosec
+	case g.knownHostsFile != "":
+		cb, err := ssh.NewKnownHostsCallback(g.knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid known_hosts file: %w", err)
+		}
+		keys.HostKeyCallback = cb
+	}
+
+	return keys, nil
+}
@@ -17,16 +17,14 @@ limitations under the License.
 package git
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"os"
-	"path/filepath"
-
-	"strings"
 
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/local"
 	"github.com/sirupsen/logrus"
 )
 
@@ -34,6 +32,24 @@ type gitOptions struct {
 	repository string
 	subdir     string
 	branch     string
+
+	username              string
+	password              string
+	token                 string
+	sshUser               string
+	sshKey                []byte
+	sshKeyFile            string
+	sshKeyPassphrase      string
+	knownHostsFile        string
+	insecureIgnoreHostKey bool
+
+	strict  bool
+	include []string
+	exclude []string
+
+	tagMode bool
+	tags    release.TagFilter
+	naming  release.Naming
 }
 
 type gitSetting func(g *gitOptions) error
@@ -62,6 +78,170 @@ func WithBranch(s string) gitSetting { //nolint:golint,revive
 	}
 }
 
+// WithBasicAuth sets the credentials used to clone HTTP(S) repositories
+func WithBasicAuth(username, password string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.username = username
+		g.password = password
+		return nil
+	}
+}
+
+// WithToken sets an access token used to clone HTTP(S) repositories, as password of the basic auth username
+// or of the "git" user. It can't be set along with a password.
+func WithToken(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.token = s
+		return nil
+	}
+}
+
+// WithSSHUser sets the user used to clone SSH repositories, defaults to "git"
+func WithSSHUser(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		if s != "" {
+			g.sshUser = s
+		}
+		return nil
+	}
+}
+
+// WithSSHKey sets the PEM encoded private key used to clone SSH repositories
+func WithSSHKey(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.sshKey = []byte(s)
+		return nil
+	}
+}
+
+// WithSSHKeyFile sets the private key file used to clone SSH repositories
+func WithSSHKeyFile(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.sshKeyFile = s
+		return nil
+	}
+}
+
+// WithSSHKeyPassphrase sets the passphrase of the SSH private key
+func WithSSHKeyPassphrase(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.sshKeyPassphrase = s
+		return nil
+	}
+}
+
+// WithKnownHostsFile sets the known_hosts file used to verify the SSH host keys
+func WithKnownHostsFile(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.knownHostsFile = s
+		return nil
+	}
+}
+
+// WithInsecureIgnoreHostKey skips the verification of the SSH host keys
+func WithInsecureIgnoreHostKey(value bool) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.insecureIgnoreHostKey = value
+		return nil
+	}
+}
+
+// WithStrict fails the discovery if any version file is invalid, instead of skipping it with a warning
+func WithStrict(value bool) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.strict = value
+		return nil
+	}
+}
+
+// WithInclude sets the glob patterns of the version files to parse, by default *.json, *.yaml and *.yml.
+// Patterns without a slash match the file name, others the path relative to the subpath.
+func WithInclude(patterns ...string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		if len(patterns) == 0 {
+			return nil
+		}
+		if err := local.ValidatePatterns(patterns); err != nil {
+			return err
+		}
+		g.include = patterns
+		return nil
+	}
+}
+
+// WithExclude sets the glob patterns of the files to ignore, matched like the WithInclude ones
+func WithExclude(patterns ...string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		if err := local.ValidatePatterns(patterns); err != nil {
+			return err
+		}
+		g.exclude = patterns
+		return nil
+	}
+}
+
+// WithTags derives the versions from the tags of the repository instead of its version files
+func WithTags(value bool) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.tagMode = value
+		return nil
+	}
+}
+
+// WithTagPattern only includes the tags matching the given regular expression
+func WithTagPattern(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		return g.tags.SetPattern(s)
+	}
+}
+
+// WithTagConstraint only includes the semver tags satisfying the given constraint
+func WithTagConstraint(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		return g.tags.SetConstraint(s)
+	}
+}
+
+// WithBaseImage Sets a base image to prefix the upgradeImage version with, in tag mode
+func WithBaseImage(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.naming.BaseImage = s
+		return nil
+	}
+}
+
+// WithVersionNamePrefix adds a prefix to the ManagedOSVersion resources created from tags
+func WithVersionNamePrefix(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.naming.NamePrefix = s
+		return nil
+	}
+}
+
+// WithVersionNameSuffix appends a suffix to the ManagedOSVersion resources created from tags
+func WithVersionNameSuffix(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.naming.NameSuffix = s
+		return nil
+	}
+}
+
+// WithVersionPrefix adds a prefix to the versions created from tags
+func WithVersionPrefix(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.naming.VersionPrefix = s
+		return nil
+	}
+}
+
+// WithVersionSuffix appends a suffix to the versions created from tags
+func WithVersionSuffix(s string) gitSetting { //nolint:golint,revive
+	return func(g *gitOptions) error {
+		g.naming.VersionSuffix = s
+		return nil
+	}
+}
+
 func (g *gitOptions) apply(opts ...gitSetting) error {
 	for _, o := range opts {
 		if err := o(g); err != nil {
@@ -73,28 +253,48 @@ func (g *gitOptions) apply(opts ...gitSetting) error {
 
 // NewReleaseFinder returns a new git release finder discovery with the required settings
 func NewReleaseFinder(opts ...gitSetting) (*releaseFinder, error) { //nolint:golint,revive
-	o := &gitOptions{}
+	o := &gitOptions{
+		sshUser: "git",
+	}
 
 	err := o.apply(opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	o.naming.Repository = o.repository
+
+	auth, err := o.auth()
+	if err != nil {
+		return nil, err
+	}
+
 	return &releaseFinder{
 		opts: *o,
+		auth: auth,
 	}, nil
 }
 
 type releaseFinder struct {
 	opts gitOptions
+	auth transport.AuthMethod
+}
+
+// String identifies the finder in the discovery errors
+func (f *releaseFinder) String() string {
+	return "git:" + f.opts.repository
 }
 
-// Discovery retrieves ManagedOSVersion from git repositories
+// Discovery retrieves ManagedOSVersion from git repositories, by running the local discovery on a shallow clone
 func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	if f.opts.tagMode {
+		return f.tagVersions()
+	}
 
 	opts := &git.CloneOptions{
 		URL:   f.opts.repository,
 		Depth: 1,
+		Auth:  f.auth,
 	}
 
 	if f.opts.branch != "" {
@@ -115,33 +315,15 @@ func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error)
 	}
 	logrus.Infof("Cloning of '%s' in '%s' done", f.opts.repository, temp)
 
-	err = filepath.Walk(filepath.Join(temp, f.opts.subdir),
-		func(path string, info os.FileInfo, err error) error {
-
-			if err != nil {
-				return nil
-			}
-			if !strings.HasSuffix(path, "json") {
-				return nil
-			}
-
-			logrus.Infof("'%s' found", path)
-
-			v := &provv1.ManagedOSVersion{}
-			dat, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			err = json.Unmarshal(dat, v)
-			if err == nil {
-				res = append(res, v)
-			}
-			return nil
-
-		})
+	files, err := local.NewReleaseFinder(
+		local.WithPath(temp),
+		local.WithSubpath(f.opts.subdir),
+		local.WithStrict(f.opts.strict),
+		local.WithInclude(f.opts.include...),
+		local.WithExclude(f.opts.exclude...),
+	)
 	if err != nil {
-		return
+		return nil, err
 	}
-
-	return
+	return files.Discovery()
 }
@@ -17,12 +17,453 @@ limitations under the License.
 package git_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
 	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/git"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+func sshKey() string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+// publicKey returns the authorized_keys line of the public key of a PEM private key
+func publicKey(key string) string {
+	signer, err := ssh.ParsePrivateKey([]byte(key))
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+// sshServer is an SSH server recording the user and public key offered by the clients, rejecting them all
+type sshServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	url      string
+
+	mu  sync.Mutex
+	key string
+}
+
+func newSSHServer() *sshServer {
+	hostKey, err := ssh.ParsePrivateKey([]byte(sshKey()))
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	s := &sshServer{
+		listener: listener,
+		hostKey:  hostKey,
+		url:      fmt.Sprintf("ssh://%s/os2.git", listener.Addr()),
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.key = conn.User() + ":" + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+			return nil, errors.New("unauthorized")
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, cfg)
+			}()
+		}
+	}()
+	return s
+}
+
+// offered returns the user and public key offered by the last client
+func (s *sshServer) offered() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key
+}
+
+func (s *sshServer) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = ""
+}
+
+// knownHost returns the known_hosts line of the server
+func (s *sshServer) knownHost() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(s.listener.Addr().String())}, s.hostKey.PublicKey())
+}
+
+func (s *sshServer) Close() {
+	s.listener.Close()
+}
+
+// newRepo creates a local git repository with the given files committed, and returns its path
+func newRepo(files map[string]string) string {
+	dir, err := os.MkdirTemp("", "git-repo")
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	repo, err := gogit.PlainInit(dir, false)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	wt, err := repo.Worktree()
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		ExpectWithOffset(1, os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		ExpectWithOffset(1, ioutil.WriteFile(path, []byte(content), os.ModePerm)).To(Succeed())
+		_, err = wt.Add(name)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	}
+
+	_, err = wt.Commit("versions", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	return dir
+}
+
+func version(name string) string {
+	return `{"metadata": {"name": "` + name + `"}, "spec": {"version": "` + name + `", "type": "container", "metadata": {"upgradeImage": "foo/bar:` + name + `"}}}`
+}
+
 var _ = Describe("git discovery", func() {
+	Context("invalid versions", func() {
+		var repo string
+
+		BeforeEach(func() {
+			repo = newRepo(map[string]string{
+				"v0.1.0.json":        version("v0.1.0"),
+				"sub/v0.2.0.json":    version("v0.2.0"),
+				"broken.json":        "{\n  \"metadata\": {\"name\": \"foo\"},\n  \"spec\": {\"version\": 1}\n}",
+				"sub/truncated.json": "{\"metadata\": ",
+				"incomplete.json":    `{"metadata": {"name": "foo"}}`,
+			})
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(repo)
+		})
+
+		It("skips invalid versions by default", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+
+			names := []string{}
+			for _, r := range res {
+				names = append(names, r.ObjectMeta.Name)
+			}
+			Expect(names).To(ConsistOf("v0.1.0", "v0.2.0"))
+		})
+
+		It("fails on invalid versions in strict mode", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithStrict(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(And(
+				ContainSubstring("broken.json:3:24"),
+				ContainSubstring("sub/truncated.json:1:14"),
+				ContainSubstring("incomplete.json: missing required fields: spec.version, spec.type"),
+			))
+		})
+
+		It("fails on missing subpaths", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithSubpath("missing"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(MatchError(ContainSubstring("missing")))
+		})
+
+		It("fails on missing subpaths in strict mode", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithSubpath("missing"), WithStrict(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("version files", func() {
+		var repo string
+
+		BeforeEach(func() {
+			repo = newRepo(map[string]string{
+				"v0.1.0.json":      version("v0.1.0"),
+				"v0.2.0.yaml":      "metadata:\n  name: v0.2.0\nspec:\n  version: v0.2.0\n  type: container\n",
+				"stream.yml":       "---\n" + version("v0.3.0") + "\n---\n# empty\n---\n" + version("v0.3.1") + "\n",
+				"array.json":       "[" + version("v0.4.0") + ", " + version("v0.4.1") + "]",
+				"list.yaml":        `{"apiVersion": "v1", "kind": "List", "items": [` + version("v0.5.0") + `]}`,
+				"drafts/v1.0.json": version("v1.0.0"),
+				"foo.notjson":      version("v9.9.9"),
+				"README.md":        "# versions",
+			})
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(repo)
+		})
+
+		It("parses json and yaml manifests", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithStrict(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0", "v0.2.0", "v0.3.0", "v0.3.1", "v0.4.0", "v0.4.1", "v0.5.0", "v1.0.0"))
+		})
+
+		It("skips hidden directories and the manifests of other kinds", func() {
+			os.RemoveAll(repo)
+			repo = newRepo(map[string]string{
+				".github/workflows/ci.yml":        "name: CI\non: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n",
+				"chart/templates/deployment.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: os2\n",
+				"kustomization.yaml":              "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources: []\n",
+				"versions/v0.1.0.yaml":            "apiVersion: rancheros.cattle.io/v1\nkind: ManagedOSVersion\nmetadata:\n  name: v0.1.0\nspec:\n  version: v0.1.0\n  type: container\n",
+			})
+
+			rf, err := NewReleaseFinder(WithRepository(repo), WithStrict(true))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0"}))
+		})
+
+		It("filters files with include and exclude patterns", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithStrict(true),
+				WithInclude("*.json"),
+				WithExclude("drafts/*", "array.json"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0"))
+		})
+
+		It("reports the invalid documents and items", func() {
+			os.RemoveAll(repo)
+			repo = newRepo(map[string]string{
+				"stream.yaml": version("v0.1.0") + "\n---\nmetadata: [\n---\n" + `[` + version("v0.2.0") + `, {"metadata": {"name": "foo"}}]`,
+			})
+
+			rf, err := NewReleaseFinder(WithRepository(repo))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0", "v0.2.0"))
+
+			rf, err = NewReleaseFinder(WithRepository(repo), WithStrict(true))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(And(
+				ContainSubstring("stream.yaml: document 2"),
+				ContainSubstring("stream.yaml: document 3: item 2: missing required fields: spec.version, spec.type"),
+			))
+		})
+
+		It("rejects invalid patterns", func() {
+			_, err := NewReleaseFinder(WithRepository(repo), WithInclude("[a-"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("tags", func() {
+		var repo string
+
+		BeforeEach(func() {
+			repo = newRepo(map[string]string{"README.md": "# versions"})
+
+			r, err := gogit.PlainOpen(repo)
+			Expect(err).ToNot(HaveOccurred())
+			head, err := r.Head()
+			Expect(err).ToNot(HaveOccurred())
+			for _, t := range []string{"v0.1.0", "v0.2.0-rc1", "v0.2.0", "latest"} {
+				_, err = r.CreateTag(t, head.Hash(), nil)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err = r.CreateTag("v0.3.0", head.Hash(), &gogit.CreateTagOptions{
+				Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+				Message: "v0.3.0",
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(repo)
+		})
+
+		It("creates versions from the tags", func() {
+			rf, err := NewReleaseFinder(
+				WithRepository(repo),
+				WithTags(true),
+				WithBaseImage("quay.io/costoolkit/os2"),
+				WithVersionPrefix("os2-"),
+				WithVersionNameSuffix("-x86"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(5))
+
+			for _, v := range res {
+				if v.Spec.Version != "os2-v0.3.0" {
+					continue
+				}
+				Expect(v.ObjectMeta.Name).To(Equal("os2-v0.3.0-x86"))
+				Expect(v.Spec.Type).To(Equal("container"))
+				Expect(v.Spec.Metadata.Data["upgradeImage"]).To(Equal("quay.io/costoolkit/os2:os2-v0.3.0"))
+				return
+			}
+			Fail("annotated tag not found")
+		})
+
+		It("filters the tags", func() {
+			rf, err := NewReleaseFinder(WithRepository(repo), WithTags(true), WithTagPattern("^v"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0", "v0.2.0-rc1", "v0.2.0", "v0.3.0"))
+
+			rf, err = NewReleaseFinder(WithRepository(repo), WithTags(true), WithTagConstraint(">= v0.2.0"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err = rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.2.0", "v0.3.0"))
+		})
+
+		It("rejects invalid filters", func() {
+			_, err := NewReleaseFinder(WithTagPattern("[a-"))
+			Expect(err).To(HaveOccurred())
+			_, err = NewReleaseFinder(WithTagConstraint("foo"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("authentication", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "git-auth")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("clones with basic auth and tokens", func() {
+			var credentials []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				user, pass, _ := req.BasicAuth()
+				credentials = append(credentials, user+":"+pass)
+				w.WriteHeader(http.StatusUnauthorized)
+			}))
+			defer srv.Close()
+
+			clone := func(rf discovery.Discoverer, err error) {
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				_, err = rf.Discovery()
+				ExpectWithOffset(1, err).To(HaveOccurred())
+			}
+			repo := WithRepository(srv.URL + "/os2.git")
+			clone(NewReleaseFinder(repo, WithBasicAuth("foo", "bar")))
+			clone(NewReleaseFinder(repo, WithToken("secret")))
+			clone(NewReleaseFinder(repo, WithBasicAuth("foo", ""), WithToken("secret")))
+			Expect(credentials).To(Equal([]string{"foo:bar", "git:secret", "foo:secret"}))
+		})
+
+		It("clones with SSH keys", func() {
+			key := sshKey()
+			srv := newSSHServer()
+			defer srv.Close()
+
+			rf, err := NewReleaseFinder(WithRepository(srv.url), WithSSHKey(key), WithInsecureIgnoreHostKey(true))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(srv.offered()).To(Equal("git:" + publicKey(key)))
+
+			keyFile := filepath.Join(dir, "id_rsa")
+			Expect(ioutil.WriteFile(keyFile, []byte(key), 0600)).To(Succeed())
+			knownHosts := filepath.Join(dir, "known_hosts")
+			Expect(ioutil.WriteFile(knownHosts, []byte{}, 0600)).To(Succeed())
+
+			// unknown host keys are rejected before authenticating
+			srv.reset()
+			rf, err = NewReleaseFinder(WithRepository(srv.url), WithSSHKeyFile(keyFile), WithKnownHostsFile(knownHosts))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(srv.offered()).To(BeEmpty())
+
+			Expect(ioutil.WriteFile(knownHosts, []byte(srv.knownHost()+"\n"), 0600)).To(Succeed())
+			rf, err = NewReleaseFinder(WithRepository(srv.url), WithSSHUser("foo"), WithSSHKeyFile(keyFile), WithKnownHostsFile(knownHosts))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(srv.offered()).To(Equal("foo:" + publicKey(key)))
+		})
+
+		It("fails with invalid settings", func() {
+			_, err := NewReleaseFinder(WithSSHKey("foo"))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReleaseFinder(WithSSHKeyFile(filepath.Join(dir, "missing")))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReleaseFinder(WithSSHKey(sshKey()), WithKnownHostsFile(filepath.Join(dir, "missing")))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReleaseFinder(WithSSHKey(sshKey()), WithToken("foo"))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReleaseFinder(WithBasicAuth("foo", "bar"), WithToken("foo"))
+			Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+
+			_, err = NewReleaseFinder(WithBasicAuth("foo", ""))
+			Expect(err).To(MatchError(ContainSubstring("without a password or token")))
+		})
+	})
+
 	Context("discovery", func() {
 		It("fails if there aren't enough information", func() {
 			rf, err := NewReleaseFinder()
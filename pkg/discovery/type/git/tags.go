@@ -0,0 +1,56 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package git
+
+import (
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/memory"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// tagVersions creates container ManagedOSVersion from the tags of the repository,
+// listed from the remote references without cloning it
+func (f *releaseFinder) tagVersions() (res []*provv1.ManagedOSVersion, err error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{f.opts.repository},
+	})
+
+	logrus.Infof("Listing tags of %s", f.opts.repository)
+	refs, err := remote.List(&git.ListOptions{Auth: f.auth})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range refs {
+		if !r.Name().IsTag() {
+			continue
+		}
+		tag := r.Name().Short()
+		if !f.opts.tags.Matches(tag) {
+			continue
+		}
+		v, err := f.opts.naming.ContainerVersion(tag, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+)
+
+// perPage is the page size requested to the Gitea API, its default maximum
+const perPage = 50
+
+// giteaRelease holds the fields of a Gitea release used to build versions
+type giteaRelease struct {
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// splitSlug returns the owner and name of an owner/name repository slug
+func splitSlug(slug string) (string, string, error) {
+	repo := strings.Split(slug, "/")
+	if len(repo) != 2 || repo[0] == "" || repo[1] == "" {
+		return "", "", fmt.Errorf("invalid repository '%s', it should be 'owner/name'", slug)
+	}
+	return repo[0], repo[1], nil
+}
+
+// releasesURL returns the URL of a page of the repository releases
+func releasesURL(o release.ForgeOptions, owner, name string, page, size int) string {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(size))
+	q.Set("page", strconv.Itoa(page))
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s/releases?%s", o.BaseURL, url.PathEscape(owner), url.PathEscape(name), q.Encode())
+}
+
+// Releases returns the releases of the repository, including the drafts visible with the token
+func (a *api) Releases(o release.ForgeOptions) ([]release.ForgeRelease, error) {
+	if o.BaseURL == "" {
+		return nil, errors.New("no Gitea URL set")
+	}
+	owner, name, err := splitSlug(o.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var rels []release.ForgeRelease
+	size := perPage
+	if o.MaxReleases > 0 && o.MaxReleases < perPage {
+		size = o.MaxReleases
+	}
+
+	for page := 1; ; page++ {
+		res, total, err := a.listReleases(o, owner, name, page, size)
+		if err != nil {
+			return nil, err
+		}
+
+		rels = append(rels, res...)
+		if o.MaxReleases > 0 && len(rels) >= o.MaxReleases {
+			return rels[:o.MaxReleases], nil
+		}
+		// the server may cap the page size below the requested one, so without a total count
+		// only an empty page ends the list
+		if len(res) == 0 || (total >= 0 && len(rels) >= total) {
+			return rels, nil
+		}
+	}
+}
+
+// listReleases returns a page of releases, along with the total number of releases or -1 if the server doesn't tell
+func (a *api) listReleases(o release.ForgeOptions, owner, name string, page, size int) ([]release.ForgeRelease, int, error) {
+	req, err := http.NewRequestWithContext(o.Ctx, http.MethodGet, releasesURL(o, owner, name, page, size), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if o.Token != "" {
+		req.Header.Set("Authorization", "token "+o.Token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// 404 means repository not found or not visible with the token. It's not an error here.
+		log.Printf("API returned 404. Repository '%s/%s' not found", owner, name)
+		return nil, 0, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("GET %s: %s: %s", req.URL.Redacted(), resp.Status, errorMessage(resp.Body))
+	}
+
+	var raw []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, 0, fmt.Errorf("decoding releases: %w", err)
+	}
+
+	rels := make([]release.ForgeRelease, len(raw))
+	for i, r := range raw {
+		var rel giteaRelease
+		if err := json.Unmarshal(r, &rel); err != nil {
+			return nil, 0, fmt.Errorf("decoding releases: %w", err)
+		}
+		rels[i] = release.ForgeRelease{Tag: rel.TagName, Name: rel.Name, Prerelease: rel.Prerelease, Draft: rel.Draft}
+		if err := json.Unmarshal(r, &rels[i].Data); err != nil {
+			return nil, 0, fmt.Errorf("decoding releases: %w", err)
+		}
+	}
+
+	total, err := strconv.Atoi(resp.Header.Get("X-Total-Count"))
+	if err != nil {
+		total = -1
+	}
+	return rels, total, nil
+}
+
+// errorMessage returns the message of a Gitea API error response, or its raw body
+func errorMessage(body io.Reader) string {
+	dat, _ := ioutil.ReadAll(io.LimitReader(body, 4096))
+	var e struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(dat, &e) == nil && e.Message != "" {
+		return e.Message
+	}
+	return string(dat)
+}
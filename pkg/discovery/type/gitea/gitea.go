@@ -0,0 +1,57 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+)
+
+// The settings of the Gitea release finder, shared with the other forges.
+// The repository is an owner/name slug, and the base URL the one of the Gitea or Forgejo instance.
+// Drafts are only listed by the API to users with write access to the repository.
+var (
+	WithRepository         = release.WithRepository
+	WithContext            = release.WithContext
+	WithToken              = release.WithToken
+	WithBaseURL            = release.WithBaseURL
+	WithBaseImage          = release.WithBaseImage
+	WithVersionNamePrefix  = release.WithVersionNamePrefix
+	WithVersionNameSuffix  = release.WithVersionNameSuffix
+	WithVersionPrefix      = release.WithVersionPrefix
+	WithVersionSuffix      = release.WithVersionSuffix
+	WithPreReleases        = release.WithPreReleases
+	WithDrafts             = release.WithDrafts
+	WithMaxReleases        = release.WithMaxReleases
+	WithDigestPinning      = release.WithDigestPinning
+	WithMissingImagePolicy = release.WithMissingImagePolicy
+	WithRegistryAuth       = release.WithRegistryAuth
+	WithRegistryToken      = release.WithRegistryToken
+	WithRegistryPlainHTTP  = release.WithRegistryPlainHTTP
+)
+
+// api lists the releases of a repository through the Gitea API
+type api struct {
+	client *http.Client
+}
+
+// NewReleaseFinder returns a new Gitea release finder discovery with the required settings
+func NewReleaseFinder(opts ...release.ForgeSetting) (*release.ForgeFinder, error) {
+	return release.NewForgeFinder("gitea", &api{client: &http.Client{Timeout: 30 * time.Second}}, "", opts...)
+}
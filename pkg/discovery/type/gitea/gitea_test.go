@@ -0,0 +1,170 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitea_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitea"
+)
+
+// maxLimit is the page size the fake server caps the requested limit to
+const maxLimit = 30
+
+// releasesHandler serves releases for the given tags like the Gitea API, paginated with page and limit.
+// Tags ending with -rc are pre-releases and tags ending with -draft drafts.
+func releasesHandler(tags ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		if limit == 0 || limit > maxLimit {
+			limit = maxLimit
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		start := (page - 1) * limit
+		if start > len(tags) {
+			start = len(tags)
+		}
+		end := start + limit
+		if end > len(tags) {
+			end = len(tags)
+		}
+
+		rels := []map[string]interface{}{}
+		for _, t := range tags[start:end] {
+			rels = append(rels, map[string]interface{}{
+				"tag_name":   t,
+				"name":       "Release " + t,
+				"prerelease": strings.HasSuffix(t, "-rc"),
+				"draft":      strings.HasSuffix(t, "-draft"),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.Itoa(len(tags)))
+		_ = json.NewEncoder(w).Encode(rels)
+	}
+}
+
+var _ = Describe("gitea discovery", func() {
+	var srv *httptest.Server
+	var tags []string
+	var requests int
+
+	BeforeEach(func() {
+		tags = []string{"v0.4.0-draft", "v0.3.0-rc", "v0.2.0", "v0.1.0"}
+		requests = 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/repos/os/os2/releases", func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			if req.Header.Get("Authorization") != "token secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"message": "token is required"}`))
+				return
+			}
+			releasesHandler(tags...)(w, req)
+		})
+		srv = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("fails if there aren't enough information", func() {
+		rf, err := NewReleaseFinder(WithRepository("os/os2"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		rf, err = NewReleaseFinder(WithBaseURL(srv.URL), WithRepository("os2"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("detect releases", func() {
+		rf, err := NewReleaseFinder(
+			WithRepository("os/os2"),
+			WithBaseURL(srv.URL),
+			WithToken("secret"),
+			WithBaseImage("registry.example.com/os/os2"),
+			WithVersionSuffix("-amd64"),
+			WithVersionNamePrefix("os2-"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Versions(res)).To(Equal([]string{"v0.2.0-amd64", "v0.1.0-amd64"}))
+		Expect(res[0].ObjectMeta.Name).To(Equal("os2-v0.2.0-amd64"))
+		Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("registry.example.com/os/os2:v0.2.0-amd64"))
+		Expect(res[0].Spec.Metadata.Data["gitea_data"]).To(HaveKeyWithValue("name", "Release v0.2.0"))
+	})
+
+	It("includes drafts and pre-releases if set", func() {
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithToken("secret"), WithPreReleases(true))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Versions(res)).To(Equal([]string{"v0.3.0-rc", "v0.2.0", "v0.1.0"}))
+
+		rf, err = NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithToken("secret"), WithDrafts(true))
+		Expect(err).ToNot(HaveOccurred())
+		res, err = rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Versions(res)).To(Equal([]string{"v0.4.0-draft", "v0.2.0", "v0.1.0"}))
+	})
+
+	It("walks all the pages", func() {
+		tags = nil
+		for i := 0; i < 100; i++ {
+			tags = append(tags, fmt.Sprintf("v0.%d.0", i))
+		}
+
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithToken("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(100))
+		Expect(res[99].Spec.Version).To(Equal("v0.99.0"))
+		Expect(requests).To(Equal(4))
+
+		rf, err = NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithToken("secret"), WithMaxReleases(40))
+		Expect(err).ToNot(HaveOccurred())
+		res, err = rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(40))
+	})
+
+	It("reports API errors", func() {
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("token is required")))
+	})
+})
@@ -0,0 +1,54 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"github.com/google/go-github/github"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+)
+
+// uploadedState is the state of the release assets which are fully uploaded
+const uploadedState = "uploaded"
+
+// assetVersions returns a ManagedOSVersion for each uploaded asset of the release matching the asset pattern,
+// adding its download URL, size and content type to the release metadata
+func (f *releaseFinder) assetVersions(r *github.RepositoryRelease, metadata map[string]interface{}) (res []*provv1.ManagedOSVersion, err error) {
+	for _, a := range r.Assets {
+		if !f.opts.assetPattern.MatchString(a.GetName()) {
+			continue
+		}
+		if s := a.GetState(); s != "" && s != uploadedState {
+			continue
+		}
+
+		data := map[string]interface{}{}
+		for k, v := range metadata {
+			data[k] = v
+		}
+		data["asset"] = a.GetName()
+		data["downloadURL"] = a.GetBrowserDownloadURL()
+		data["size"] = a.GetSize()
+		data["contentType"] = a.GetContentType()
+
+		v, err := f.opts.naming.AssetVersion(r.GetTagName(), r.GetName(), a.GetName(), f.opts.assetType, data)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return
+}
@@ -0,0 +1,209 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const defaultBaseURL = "https://api.github.com/"
+
+// tokenSource returns the source of the tokens used against the Github API, or nil for anonymous requests.
+// hc is the client used to request the Github App installation tokens.
+func (g *githubOptions) tokenSource(hc *http.Client) (oauth2.TokenSource, error) {
+	set := 0
+	for _, ok := range []bool{g.githubToken != "", g.tokenFile != "", g.appID != 0} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("only one of token, token file and Github App authentication can be set")
+	}
+
+	switch {
+	case g.githubToken != "":
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: g.githubToken}), nil
+	case g.tokenFile != "":
+		src := &fileTokenSource{path: g.tokenFile}
+		if _, err := src.Token(); err != nil {
+			return nil, err
+		}
+		return src, nil
+	case g.appID != 0:
+		key, err := readPrivateKey(g.appKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		baseURL := g.baseURL
+		if baseURL == "" {
+			baseURL = defaultBaseURL
+		}
+		return oauth2.ReuseTokenSource(nil, &appTokenSource{
+			ctx:            g.ctx,
+			appID:          g.appID,
+			installationID: g.installationID,
+			key:            key,
+			url:            fmt.Sprintf("%s/app/installations/%d/access_tokens", strings.TrimSuffix(baseURL, "/"), g.installationID),
+			client:         hc,
+		}), nil
+	}
+	return nil, nil
+}
+
+// credentialsID returns a stable identity of the credentials, keying the cached responses. Unlike the tokens,
+// it doesn't change with the installation tokens minted for Github Apps on every run. It's hashed in the keys.
+func (g *githubOptions) credentialsID() string {
+	switch {
+	case g.githubToken != "":
+		return "token:" + g.githubToken
+	case g.tokenFile != "":
+		return "file:" + g.tokenFile
+	case g.appID != 0:
+		return fmt.Sprintf("app:%d/%d", g.appID, g.installationID)
+	}
+	return ""
+}
+
+// fileTokenSource reads the token from a file on every request, so it can be rotated
+type fileTokenSource struct {
+	path string
+}
+
+// Token implements oauth2.TokenSource
+func (s *fileTokenSource) Token() (*oauth2.Token, error) {
+	dat, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(dat))
+	if token == "" {
+		return nil, fmt.Errorf("token file '%s' is empty", s.path)
+	}
+	return &oauth2.Token{AccessToken: token}, nil
+}
+
+// appTokenSource requests installation tokens of a Github App, authenticated with a JWT signed by the App private key
+type appTokenSource struct {
+	ctx            context.Context
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	url            string
+	client         *http.Client
+}
+
+// Token implements oauth2.TokenSource
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("requesting a token for the installation %d of the Github App %d: %s: %s", s.installationID, s.appID, res.Status, strings.TrimSpace(string(body)))
+	}
+
+	token := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token.Token, Expiry: token.ExpiresAt}, nil
+}
+
+// jwt returns a JWT identifying the Github App, valid for 10 minutes at most as required by Github.
+// It's issued a minute in the past to allow for clock drift.
+func (s *appTokenSource) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// readPrivateKey reads a PEM encoded RSA private key, in PKCS#1 as generated by Github or PKCS#8
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key file '%s'", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key file '%s': %w", path, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key file '%s' is not an RSA key", path)
+	}
+	return rsaKey, nil
+}
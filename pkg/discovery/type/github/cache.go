@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultCacheMaxStaleness is how old cached responses can be to be used when the Github API is unreachable by default
+const DefaultCacheMaxStaleness = 24 * time.Hour
+
+// cacheTransport stores the responses of the Github API in a directory. Requests are made conditional
+// with the stored ETag or Last-Modified headers, so unchanged responses don't use the rate limit quota,
+// and the stored responses are served if the API is unreachable or no token can be obtained.
+type cacheTransport struct {
+	dir string
+	// credentials identifies the credentials the responses depend on
+	credentials  string
+	maxStaleness time.Duration
+	next         http.RoundTripper
+}
+
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	Date         time.Time   `json:"date"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+
+	path := t.path(req)
+	entry := t.load(path)
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil || res.StatusCode >= http.StatusInternalServerError:
+		if entry == nil || time.Since(entry.Date) > t.maxStaleness {
+			return res, err
+		}
+		if err == nil {
+			res.Body.Close()
+		}
+		log.Printf("Github API unreachable, using the response cached at %s for %s", entry.Date.Format(time.RFC3339), entry.URL)
+		return entry.response(req, nil), nil
+	case res.StatusCode == http.StatusNotModified && entry != nil:
+		res.Body.Close()
+		entry.Date = time.Now()
+		t.save(path, entry)
+		return entry.response(req, res.Header), nil
+	case res.StatusCode != http.StatusOK:
+		return res, nil
+	}
+
+	etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.save(path, &cacheEntry{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		Header:       res.Header,
+		Body:         body,
+		Date:         time.Now(),
+	})
+	return res, nil
+}
+
+// path returns the cache file of a request. Responses depend on the credentials, whose identity is part of the key.
+func (t *cacheTransport) path(req *http.Request) string {
+	key := sha256.Sum256([]byte(req.URL.String() + "\n" + t.credentials))
+	return filepath.Join(t.dir, fmt.Sprintf("%x.json", key))
+}
+
+func (t *cacheTransport) load(path string) *cacheEntry {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(dat, entry); err != nil {
+		log.Printf("Ignoring invalid cache file %s: %s", path, err)
+		return nil
+	}
+	return entry
+}
+
+// save writes a cache entry, failures only lose the cache and are logged
+func (t *cacheTransport) save(path string, entry *cacheEntry) {
+	if err := writeEntry(path, entry); err != nil {
+		log.Printf("Failed caching the response for %s: %s", entry.URL, err)
+	}
+}
+
+func writeEntry(path string, entry *cacheEntry) error {
+	dat, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// response returns the cached response, with the headers of the current response if any,
+// so the rate limit quota is up to date
+func (e *cacheEntry) response(req *http.Request, header http.Header) *http.Response {
+	h := e.Header.Clone()
+	for k, v := range header {
+		h[k] = v
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
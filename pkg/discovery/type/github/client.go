@@ -0,0 +1,93 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/internal/httputil"
+	"golang.org/x/oauth2"
+)
+
+// newClient returns a Github API client for github.com, or for a Github Enterprise server if a base URL is set
+func newClient(o *githubOptions) (*github.Client, error) {
+	hc, err := newHTTPClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.baseURL == "" {
+		return github.NewClient(hc), nil
+	}
+
+	upload := o.uploadURL
+	if upload == "" {
+		upload = o.baseURL
+	}
+	return github.NewEnterpriseClient(o.baseURL, upload, hc)
+}
+
+// newHTTPClient returns the client of the Github API. The response cache wraps the authentication, so it's
+// keyed on the credentials identity rather than on tokens which change on every run, and serves the cached
+// responses when no token can be minted either.
+func newHTTPClient(o *githubOptions) (*http.Client, error) {
+	transport, err := httputil.NewTransport(o.caBundleFile, o.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+	src, err := o.tokenSource(hc)
+	if err != nil {
+		return nil, err
+	}
+
+	var next http.RoundTripper = transport
+	if src != nil {
+		next = &oauth2.Transport{Source: src, Base: transport}
+	}
+	if o.cacheDir != "" {
+		next = &cacheTransport{
+			dir:          o.cacheDir,
+			credentials:  o.credentialsID(),
+			maxStaleness: o.cacheMaxStaleness,
+			next:         next,
+		}
+	}
+	return &http.Client{
+		Timeout:   hc.Timeout,
+		Transport: next,
+	}, nil
+}
+
+// newDownloadClient returns the client following the asset download redirects, which point to other hosts
+// and mustn't get the Github credentials
+func newDownloadClient(o *githubOptions) (*http.Client, error) {
+	transport, err := httputil.NewTransport(o.caBundleFile, o.proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}, nil
+}
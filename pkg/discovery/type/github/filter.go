@@ -0,0 +1,87 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// dateLayout is the layout of the dates accepted besides RFC 3339 times
+const dateLayout = "2006-01-02"
+
+// parseDate parses an RFC 3339 time or a YYYY-MM-DD date, taken as midnight UTC. An empty string is the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s', must be an RFC 3339 time or a YYYY-MM-DD date", s)
+	}
+	return t, nil
+}
+
+// included returns true if the release passes the state, date and tag filters
+func (g *githubOptions) included(r *github.RepositoryRelease) bool {
+	// skip pre-releases and drafts unless we explicitly include them
+	if r.GetPrerelease() && !g.includePreReleases {
+		return false
+	}
+	if r.GetDraft() && !g.includeDrafts {
+		return false
+	}
+	if !g.tags.Matches(r.GetTagName()) {
+		return false
+	}
+	if g.publishedAfter.IsZero() && g.publishedBefore.IsZero() {
+		return true
+	}
+
+	// drafts aren't published yet, they're dated by their creation
+	published := r.GetPublishedAt().Time
+	if published.IsZero() {
+		published = r.GetCreatedAt().Time
+	}
+	if !g.publishedAfter.IsZero() && !published.After(g.publishedAfter) {
+		return false
+	}
+	return g.publishedBefore.IsZero() || published.Before(g.publishedBefore)
+}
+
+// findLatest returns the release marked as latest, if any
+func (f *releaseFinder) findLatest(owner, name string) ([]*github.RepositoryRelease, error) {
+	var rel *github.RepositoryRelease
+	res, err := f.withRateLimit(func() (res *github.Response, err error) {
+		rel, res, err = f.api.Repositories.GetLatestRelease(f.opts.ctx, owner, name)
+		return
+	})
+	if err != nil {
+		if res != nil && res.StatusCode == 404 {
+			log.Println("API returned 404. Repository or latest release not found")
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []*github.RepositoryRelease{rel}, nil
+}
@@ -18,29 +18,57 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
 	"time"
 
 	"strings"
 
 	"github.com/google/go-github/github"
+	"github.com/hashicorp/go-multierror"
 	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
-	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
-	"golang.org/x/oauth2"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
 )
 
 type githubOptions struct {
-	versionNamePrefix  string
-	versionNameSuffix  string
-	versionSuffix      string
-	versionPrefix      string
-	baseImage          string
+	naming             release.Naming
 	githubToken        string
 	repository         string
 	includePreReleases bool
+	maxReleases        int
+	digestPinning      bool
+	missingImages      release.MissingImagePolicy
+	registryUsername   string
+	registryPassword   string
+	registryToken      string
+	registryPlainHTTP  bool
+	baseURL            string
+	uploadURL          string
+	caBundleFile       string
+	proxy              *url.URL
+	rateLimitTimeout   time.Duration
+	cacheDir           string
+	cacheMaxStaleness  time.Duration
+	tokenFile          string
+	appID              int64
+	installationID     int64
+	appKeyFile         string
+	metadataProfile    release.MetadataProfile
+	metadataFields     []release.Selector
+	assetPattern       *regexp.Regexp
+	assetType          string
+	bodyManifest       bool
+	manifestAsset      string
+	includeDrafts      bool
+	latestOnly         bool
+	publishedAfter     time.Time
+	publishedBefore    time.Time
+	tags               release.TagFilter
 	ctx                context.Context
 }
 
@@ -70,10 +98,84 @@ func WithToken(s string) githubSetting { //nolint:golint,revive
 	}
 }
 
+// WithTokenFile reads the Github token from a file, e.g. mounted from a secret. It's read again on each request.
+func WithTokenFile(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.tokenFile = s
+		return nil
+	}
+}
+
+// WithApp authenticates as an installation of a Github App, with short-lived tokens
+// requested with the App private key and refreshed before they expire
+func WithApp(appID, installationID int64, privateKeyFile string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if appID == 0 && installationID == 0 && privateKeyFile == "" {
+			return nil
+		}
+		if appID <= 0 || installationID <= 0 || privateKeyFile == "" {
+			return errors.New("an app ID, an installation ID and a private key file are required for Github App authentication")
+		}
+		g.appID = appID
+		g.installationID = installationID
+		g.appKeyFile = privateKeyFile
+		return nil
+	}
+}
+
+// WithVersionTemplate renders the versions with a Go template instead of adding the version prefix and suffix to the tag
+func WithVersionTemplate(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		return g.naming.SetVersionTemplate(s)
+	}
+}
+
+// WithNameTemplate renders the ManagedOSVersion names with a Go template, sanitized to be valid Kubernetes names
+func WithNameTemplate(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		return g.naming.SetNameTemplate(s)
+	}
+}
+
+// WithImageTemplate renders the upgrade images with a Go template instead of tagging the base image with the version
+func WithImageTemplate(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		return g.naming.SetImageTemplate(s)
+	}
+}
+
+// WithMetadataProfile sets which release data is added to the version metadata, the full release by default
+func WithMetadataProfile(p release.MetadataProfile) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if p == "" {
+			return nil
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		g.metadataProfile = p
+		return nil
+	}
+}
+
+// WithMetadataFields adds fields of the release to the version metadata with "key=.path" selectors, e.g. author=.author.login
+func WithMetadataFields(selectors ...string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		for _, s := range selectors {
+			sel, err := release.ParseSelector(s)
+			if err != nil {
+				return err
+			}
+			g.metadataFields = append(g.metadataFields, sel)
+		}
+		return nil
+	}
+}
+
 // WithBaseImage Sets a base image to prefix the upgradeImage version with.
 func WithBaseImage(s string) githubSetting { //nolint:golint,revive
 	return func(g *githubOptions) error {
-		g.baseImage = s
+		g.naming.BaseImage = s
 		return nil
 	}
 }
@@ -81,7 +183,7 @@ func WithBaseImage(s string) githubSetting { //nolint:golint,revive
 // WithVersionNamePrefix adds a prefix to the created ManagedOSVersion resource
 func WithVersionNamePrefix(s string) githubSetting { //nolint:golint,revive
 	return func(g *githubOptions) error {
-		g.versionNamePrefix = s
+		g.naming.NamePrefix = s
 		return nil
 	}
 }
@@ -89,7 +191,7 @@ func WithVersionNamePrefix(s string) githubSetting { //nolint:golint,revive
 // WithVersionNameSuffix appends a suffix to the created ManagedOSVersion resource
 func WithVersionNameSuffix(s string) githubSetting { //nolint:golint,revive
 	return func(g *githubOptions) error {
-		g.versionNameSuffix = s
+		g.naming.NameSuffix = s
 		return nil
 	}
 }
@@ -105,7 +207,7 @@ func WithPreReleases(value bool) githubSetting { //nolint:golint,revive
 // WithVersionSuffix appends a suffix to the retrieved version
 func WithVersionSuffix(s string) githubSetting { //nolint:golint,revive
 	return func(g *githubOptions) error {
-		g.versionSuffix = s
+		g.naming.VersionSuffix = s
 		return nil
 	}
 }
@@ -113,11 +215,252 @@ func WithVersionSuffix(s string) githubSetting { //nolint:golint,revive
 // WithVersionPrefix adds a prefix to the retrieved version
 func WithVersionPrefix(s string) githubSetting { //nolint:golint,revive
 	return func(g *githubOptions) error {
-		g.versionPrefix = s
+		g.naming.VersionPrefix = s
+		return nil
+	}
+}
+
+// WithMaxReleases caps the number of releases retrieved from the Github API.
+// A value of 0 (the default) walks all the available pages.
+func WithMaxReleases(n int) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if n < 0 {
+			return fmt.Errorf("max releases can't be negative: %d", n)
+		}
+		g.maxReleases = n
+		return nil
+	}
+}
+
+// WithDigestPinning resolves the upgrade images against the registry and pins them to their digest
+func WithDigestPinning(value bool) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.digestPinning = value
+		return nil
+	}
+}
+
+// WithMissingImagePolicy sets how versions whose upgrade image doesn't exist are handled when pinning digests
+func WithMissingImagePolicy(p release.MissingImagePolicy) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if p == "" {
+			return nil
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		g.missingImages = p
+		return nil
+	}
+}
+
+// WithRegistryAuth sets the credentials used against the registry when pinning digests
+func WithRegistryAuth(username, password string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.registryUsername = username
+		g.registryPassword = password
+		return nil
+	}
+}
+
+// WithRegistryToken sets a bearer token used against the registry when pinning digests
+func WithRegistryToken(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.registryToken = s
+		return nil
+	}
+}
+
+// WithRegistryPlainHTTP talks to the registry over plain HTTP when pinning digests
+func WithRegistryPlainHTTP(value bool) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.registryPlainHTTP = value
 		return nil
 	}
 }
 
+// WithBaseURL sets the API URL of a Github Enterprise server, e.g. https://github.example.com/api/v3/
+func WithBaseURL(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if s == "" {
+			return nil
+		}
+		if err := validateURL("base", s); err != nil {
+			return err
+		}
+		g.baseURL = s
+		return nil
+	}
+}
+
+// WithUploadURL sets the upload URL of a Github Enterprise server, it defaults to the base URL
+func WithUploadURL(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if s == "" {
+			return nil
+		}
+		if err := validateURL("upload", s); err != nil {
+			return err
+		}
+		g.uploadURL = s
+		return nil
+	}
+}
+
+// validateURL checks the URL is an absolute HTTP(S) one, so mistakes are reported when parsing the settings
+func validateURL(kind, s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid %s URL '%s', must be an http or https one", kind, s)
+	}
+	return nil
+}
+
+// WithCABundleFile adds the PEM certificates of a file to the authorities trusted by the Github API client
+func WithCABundleFile(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.caBundleFile = s
+		return nil
+	}
+}
+
+// WithProxy sends the Github API requests through a proxy, instead of the one set in the environment
+func WithProxy(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if s == "" {
+			return nil
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL '%s': %w", s, err)
+		}
+		g.proxy = u
+		return nil
+	}
+}
+
+// WithRateLimitTimeout sets how long the discovery waits for the Github API rate limits to reset,
+// within the deadline of the context. A value of 0 fails as soon as a rate limit is hit.
+func WithRateLimitTimeout(d time.Duration) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if d < 0 {
+			return fmt.Errorf("invalid rate limit timeout %s, must be positive", d)
+		}
+		g.rateLimitTimeout = d
+		return nil
+	}
+}
+
+// WithCacheDir stores the Github API responses in a directory, to send conditional requests
+// and to fall back to the cached releases when the API is unreachable
+func WithCacheDir(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.cacheDir = s
+		return nil
+	}
+}
+
+// WithCacheMaxStaleness sets how old the cached responses can be to be used when the API is unreachable.
+// A value of 0 never uses them.
+func WithCacheMaxStaleness(d time.Duration) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if d < 0 {
+			return fmt.Errorf("invalid cache max staleness %s, must be positive", d)
+		}
+		g.cacheMaxStaleness = d
+		return nil
+	}
+}
+
+// WithAssetPattern builds a ManagedOSVersion for each release asset whose name matches the regular expression,
+// instead of a container version for each release
+func WithAssetPattern(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if s == "" {
+			return nil
+		}
+		r, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("invalid asset pattern '%s': %w", s, err)
+		}
+		g.assetPattern = r
+		return nil
+	}
+}
+
+// WithAssetType sets the ManagedOSVersion type of the versions built from release assets, container by default
+func WithAssetType(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		if s != "" {
+			g.assetType = s
+		}
+		return nil
+	}
+}
+
+// WithBodyManifest merges the first fenced YAML or JSON block of the release notes into the versions of the release
+func WithBodyManifest(b bool) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.bodyManifest = b
+		return nil
+	}
+}
+
+// WithManifestAsset merges the release asset with the given name into the versions of the release.
+// It takes precedence over the release notes manifest.
+func WithManifestAsset(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.manifestAsset = s
+		return nil
+	}
+}
+
+// WithDrafts includes the draft releases, only listed by the API to tokens with push access to the repository
+func WithDrafts(value bool) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.includeDrafts = value
+		return nil
+	}
+}
+
+// WithLatestOnly only retrieves the release marked as latest, which is never a draft or a pre-release
+func WithLatestOnly(value bool) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		g.latestOnly = value
+		return nil
+	}
+}
+
+// WithPublishedAfter only includes the releases published after the given RFC 3339 time or YYYY-MM-DD date
+func WithPublishedAfter(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) (err error) {
+		g.publishedAfter, err = parseDate(s)
+		return
+	}
+}
+
+// WithPublishedBefore only includes the releases published before the given RFC 3339 time or YYYY-MM-DD date
+func WithPublishedBefore(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) (err error) {
+		g.publishedBefore, err = parseDate(s)
+		return
+	}
+}
+
+// WithTagPattern only includes the releases whose tag matches the given regular expression
+func WithTagPattern(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		return g.tags.SetPattern(s)
+	}
+}
+
+// WithTagConstraint only includes the releases whose tag is a semver satisfying the given constraint
+func WithTagConstraint(s string) githubSetting { //nolint:golint,revive
+	return func(g *githubOptions) error {
+		return g.tags.SetConstraint(s)
+	}
+}
+
 func (g *githubOptions) apply(opts ...githubSetting) error {
 	for _, o := range opts {
 		if err := o(g); err != nil {
@@ -127,56 +470,110 @@ func (g *githubOptions) apply(opts ...githubSetting) error {
 	return nil
 }
 
+// perPage is the maximum page size allowed by the Github API
+const perPage = 100
+
 type releaseFinder struct {
-	api  *github.Client
-	opts githubOptions
-}
+	api      *github.Client
+	download *http.Client
+	registry *oci.Client
+	opts     githubOptions
 
-func newHTTPClient(ctx context.Context, token string) *http.Client {
-	if token == "" {
-		return &http.Client{
-			Timeout: 30 * time.Second,
-		}
-	}
-	src := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	return oauth2.NewClient(ctx, src)
+	// rate is the rate limit status of the last API response
+	rate github.Rate
 }
 
 // NewReleaseFinder returns a new Github release finder discovery with the required settings
 func NewReleaseFinder(opts ...githubSetting) (*releaseFinder, error) { //nolint:golint,revive
 	o := &githubOptions{
-		ctx: context.Background(),
+		ctx:               context.Background(),
+		missingImages:     release.MissingImageDrop,
+		rateLimitTimeout:  DefaultRateLimitTimeout,
+		cacheMaxStaleness: DefaultCacheMaxStaleness,
+		metadataProfile:   release.MetadataFull,
+		assetType:         release.ContainerType,
 	}
 
 	err := o.apply(opts...)
 	if err != nil {
 		return nil, err
 	}
+	o.naming.Repository = o.repository
+
+	cli, err := newClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	download, err := newDownloadClient(o)
+	if err != nil {
+		return nil, err
+	}
 
-	hc := newHTTPClient(o.ctx, o.githubToken)
-	cli := github.NewClient(hc)
+	reg, err := oci.NewClient(
+		oci.WithContext(o.ctx),
+		oci.WithBasicAuth(o.registryUsername, o.registryPassword),
+		oci.WithToken(o.registryToken),
+		oci.WithPlainHTTP(o.registryPlainHTTP),
+	)
+	if err != nil {
+		return nil, err
+	}
 
 	return &releaseFinder{
-		api:  cli,
-		opts: *o,
+		api:      cli,
+		download: download,
+		registry: reg,
+		opts:     *o,
 	}, nil
 }
 
-func (f *releaseFinder) findAll(slug string) ([]*github.RepositoryRelease, error) {
+// String identifies the finder in the discovery errors
+func (f *releaseFinder) String() string {
+	return "github:" + f.opts.repository
+}
+
+// splitSlug returns the owner and name of an owner/name repository slug
+func splitSlug(slug string) (string, string, error) {
 	repo := strings.Split(slug, "/")
 	if len(repo) != 2 || repo[0] == "" || repo[1] == "" {
-		return nil, fmt.Errorf("Invalid slug format. It should be 'owner/name': %s", slug)
+		return "", "", fmt.Errorf("Invalid slug format. It should be 'owner/name': %s", slug)
 	}
+	return repo[0], repo[1], nil
+}
 
-	rels, res, err := f.api.Repositories.ListReleases(f.opts.ctx, repo[0], repo[1], nil)
-	if err != nil {
-		log.Println("API returned an error response:", err)
-		if res != nil && res.StatusCode == 404 {
-			// 404 means repository not found or release not found. It's not an error here.
-			err = nil
-			log.Println("API returned 404. Repository or release not found")
+func (f *releaseFinder) findAll(owner, name string) ([]*github.RepositoryRelease, error) {
+	if f.opts.latestOnly {
+		return f.findLatest(owner, name)
+	}
+
+	var rels []*github.RepositoryRelease
+	opts := &github.ListOptions{PerPage: perPage}
+	if f.opts.maxReleases > 0 && f.opts.maxReleases < perPage {
+		opts.PerPage = f.opts.maxReleases
+	}
+
+	for {
+		page, res, err := f.listReleases(owner, name, opts)
+		if err != nil {
+			log.Println("API returned an error response:", err)
+			if res != nil && res.StatusCode == 404 {
+				// 404 means repository not found or release not found. It's not an error here.
+				err = nil
+				log.Println("API returned 404. Repository or release not found")
+			}
+			return nil, err
 		}
-		return nil, err
+
+		rels = append(rels, page...)
+		if f.opts.maxReleases > 0 && len(rels) >= f.opts.maxReleases {
+			return rels[:f.opts.maxReleases], nil
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
 	}
 
 	return rels, nil
@@ -184,31 +581,77 @@ func (f *releaseFinder) findAll(slug string) ([]*github.RepositoryRelease, error
 
 // Discovery retrieves ManagedOSVersion from github releases
 func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
-	rels, err := f.findAll(f.opts.repository)
+	owner, name, err := splitSlug(f.opts.repository)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.logQuota()
+
+	rels, err := f.findAll(owner, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var included []*github.RepositoryRelease
 	for _, r := range rels {
 
-		// skip pre-releases unless we explicitly include them
-		if *r.Prerelease && !f.opts.includePreReleases {
+		if !f.opts.included(r) {
+			continue
+		}
+		included = append(included, r)
+	}
+
+	var commits map[string]string
+	if f.opts.metadataProfile == release.MetadataCurated {
+		commits, err = f.tagCommits(owner, name, included)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var errs *multierror.Error
+	for _, r := range included {
+		metadata, err := f.metadata(r, commits)
+		if err != nil {
+			return nil, err
+		}
+
+		versions, err := f.releaseVersions(r, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest, err := f.manifest(owner, name, r)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("release '%s': %w", r.GetTagName(), err))
 			continue
 		}
+		for _, v := range versions {
+			mergeManifest(v, manifest, f.opts.assetPattern != nil)
+		}
+		res = append(res, versions...)
+	}
+
+	if f.opts.digestPinning {
+		res, err = release.PinDigests(f.registry, res, f.opts.missingImages)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return res, errs.ErrorOrNil()
+}
+
+// releaseVersions returns the versions of a release: a version for each matching asset in asset mode,
+// a container version otherwise
+func (f *releaseFinder) releaseVersions(r *github.RepositoryRelease, metadata map[string]interface{}) ([]*provv1.ManagedOSVersion, error) {
+	if f.opts.assetPattern != nil {
+		return f.assetVersions(r, metadata)
+	}
 
-		v := strings.Join([]string{f.opts.versionPrefix, *r.TagName, f.opts.versionSuffix}, "")
-
-		res = append(res, &provv1.ManagedOSVersion{
-			ObjectMeta: v1.ObjectMeta{
-				Name: strings.Join([]string{f.opts.versionNamePrefix, v, f.opts.versionNameSuffix}, ""),
-			},
-			Spec: provv1.ManagedOSVersionSpec{
-				Type:    "container",
-				Version: v,
-				Metadata: &v1alpha1.GenericMap{
-					Data: map[string]interface{}{
-						"upgradeImage": fmt.Sprintf("%s:%s", f.opts.baseImage, v),
-						"github_data":  r,
-					},
-				},
-			},
-		})
-	}
-	return
+	v, err := f.opts.naming.ContainerVersion(r.GetTagName(), r.GetName(), metadata)
+	if err != nil {
+		return nil, err
+	}
+	return []*provv1.ManagedOSVersion{v}, nil
 }
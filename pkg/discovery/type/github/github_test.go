@@ -17,12 +17,818 @@ limitations under the License.
 package github_test
 
 import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
 	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/github"
 )
 
+// releasesHandler serves releases for the given tags like the Github API, paginated with page and per_page
+func releasesHandler(tags ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		if perPage == 0 {
+			perPage = 30
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		start := (page - 1) * perPage
+		if start > len(tags) {
+			start = len(tags)
+		}
+		end := start + perPage
+		if end < len(tags) {
+			next := *req.URL
+			q := next.Query()
+			q.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = q.Encode()
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, req.Host, next.RequestURI()))
+		} else {
+			end = len(tags)
+		}
+
+		var rels []map[string]interface{}
+		for _, t := range tags[start:end] {
+			rels = append(rels, map[string]interface{}{
+				"tag_name":     t,
+				"name":         t,
+				"prerelease":   false,
+				"html_url":     "https://github.com/foo/bar/releases/tag/" + t,
+				"published_at": "2022-03-01T10:00:00Z",
+				"author":       map[string]interface{}{"login": "foo"},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rels)
+	}
+}
+
+func tagsOf(n int) (tags []string) {
+	for i := 0; i < n; i++ {
+		tags = append(tags, fmt.Sprintf("v0.%d.0", i))
+	}
+	return
+}
+
 var _ = Describe("github discovery", func() {
+	Context("enterprise", func() {
+		It("lists all the releases from the API base URL", func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/v3/repos/foo/bar/releases", func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				releasesHandler(tagsOf(150)...)(w, req)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithToken("secret"), WithBaseURL(srv.URL+"/api/v3"))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(150))
+			Expect(res[149].Spec.Version).To(Equal("v0.149.0"))
+		})
+
+		It("trusts a custom CA bundle", func() {
+			srv := httptest.NewTLSServer(releasesHandler("v0.1.0"))
+			defer srv.Close()
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+
+			dir, err := os.MkdirTemp("", "github-ca")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			bundle := filepath.Join(dir, "ca.pem")
+			Expect(ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: srv.Certificate().Raw,
+			}), 0600)).To(Succeed())
+
+			rf, err = NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithCABundleFile(bundle))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			Expect(ioutil.WriteFile(bundle, []byte("foo"), 0600)).To(Succeed())
+			_, err = NewReleaseFinder(WithCABundleFile(bundle))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects invalid URLs", func() {
+			for _, u := range []string{"github.example.com", "github.example.com/api/v3", "ftp://github.example.com", "https://"} {
+				_, err := NewReleaseFinder(WithBaseURL(u))
+				Expect(err).To(HaveOccurred())
+				_, err = NewReleaseFinder(WithUploadURL(u))
+				Expect(err).To(HaveOccurred())
+			}
+		})
+
+		It("goes through a proxy", func() {
+			var proxied []string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				proxied = append(proxied, req.URL.Host)
+				releasesHandler("v0.1.0", "v0.2.0")(w, req)
+			}))
+			defer proxy.Close()
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL("http://github.example.com/api/v3/"), WithProxy(proxy.URL))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+			Expect(proxied).To(ConsistOf("github.example.com"))
+		})
+	})
+
+	Context("rate limits", func() {
+		var requests int
+		var limited func(w http.ResponseWriter)
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			requests = 0
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests++
+				if requests == 1 {
+					limited(w)
+					return
+				}
+				releasesHandler("v0.1.0")(w, req)
+			}))
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		primary := func(reset time.Duration) func(w http.ResponseWriter) {
+			return func(w http.ResponseWriter) {
+				w.Header().Set("X-RateLimit-Limit", "60")
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(reset).Unix(), 10))
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message": "API rate limit exceeded for 127.0.0.1."}`))
+			}
+		}
+
+		secondary := func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "You have exceeded a secondary rate limit.", "documentation_url": "https://docs.github.com/rest/overview/resources-in-the-rest-api#secondary-rate-limits"}`))
+		}
+
+		It("waits for the primary rate limit to reset", func() {
+			limited = primary(time.Second)
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(requests).To(Equal(2))
+		})
+
+		It("retries after secondary rate limits", func() {
+			limited = secondary
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(requests).To(Equal(2))
+		})
+
+		It("fails if the rate limit doesn't reset in time", func() {
+			limited = primary(time.Hour)
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(MatchError(ContainSubstring("rate limit")))
+			Expect(requests).To(Equal(1))
+		})
+
+		It("bounds the wait with the timeout and the context", func() {
+			limited = secondary
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithRateLimitTimeout(0))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+
+			requests = 0
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			rf, err = NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithContext(ctx))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(Equal(1))
+
+			_, err = NewReleaseFinder(WithRateLimitTimeout(-time.Second))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("cache", func() {
+		var dir string
+		var requests, notModified int
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "github-cache")
+			Expect(err).ToNot(HaveOccurred())
+
+			requests, notModified = 0, 0
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests++
+				etag := `"` + req.URL.Query().Get("page") + `"`
+				if req.Header.Get("If-None-Match") == etag {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				releasesHandler(tagsOf(3)...)(w, req)
+			}))
+		})
+
+		AfterEach(func() {
+			srv.Close()
+			os.RemoveAll(dir)
+		})
+
+		discover := func() ([]string, error) {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMaxReleases(3), WithCacheDir(dir), WithRateLimitTimeout(0))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			var versions []string
+			for _, v := range res {
+				versions = append(versions, v.Spec.Version)
+			}
+			return versions, err
+		}
+
+		It("sends conditional requests", func() {
+			first, err := discover()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).To(HaveLen(3))
+			Expect(notModified).To(Equal(0))
+
+			second, err := discover()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second).To(Equal(first))
+			Expect(notModified).To(Equal(requests / 2))
+		})
+
+		It("falls back to the cache when the API is unreachable", func() {
+			first, err := discover()
+			Expect(err).ToNot(HaveOccurred())
+
+			srv.Close()
+			second, err := discover()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second).To(Equal(first))
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithCacheDir(dir), WithMaxReleases(3), WithCacheMaxStaleness(0))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("metadata", func() {
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			mux := http.NewServeMux()
+			mux.Handle("/repos/foo/bar/releases", releasesHandler("v0.1.0"))
+			mux.HandleFunc("/repos/foo/bar/tags", func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`[{"name": "v0.1.0", "commit": {"sha": "c0ffee"}}]`))
+			})
+			srv = httptest.NewServer(mux)
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		discover := func(profile release.MetadataProfile, fields ...string) map[string]interface{} {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMetadataProfile(profile), WithMetadataFields(fields...))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			return res[0].Spec.Metadata.Data
+		}
+
+		It("adds the full release by default", func() {
+			Expect(discover("")).To(HaveKey("github_data"))
+		})
+
+		It("adds curated fields", func() {
+			Expect(discover(release.MetadataCurated)).To(Equal(map[string]interface{}{
+				"upgradeImage": ":v0.1.0",
+				"tag":          "v0.1.0",
+				"prerelease":   false,
+				"releaseURL":   "https://github.com/foo/bar/releases/tag/v0.1.0",
+				"publishedAt":  "2022-03-01T10:00:00Z",
+				"commitSHA":    "c0ffee",
+			}))
+		})
+
+		It("looks up only the tags of releases which don't target a commit", func() {
+			sha := strings.Repeat("a", 40)
+			tagRequests := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/foo/bar/releases", func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte(`[{"tag_name": "v0.2.0", "target_commitish": "` + sha + `", "prerelease": false}, {"tag_name": "v0.1.0", "target_commitish": "main", "prerelease": false}]`))
+			})
+			mux.HandleFunc("/repos/foo/bar/tags", func(w http.ResponseWriter, req *http.Request) {
+				tagRequests++
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s/repos/foo/bar/tags?page=2>; rel="next"`, req.Host))
+				_, _ = w.Write([]byte(`[{"name": "v0.1.0", "commit": {"sha": "c0ffee"}}]`))
+			})
+			s := httptest.NewServer(mux)
+			defer s.Close()
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(s.URL), WithMetadataProfile(release.MetadataCurated))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+			Expect(res[0].Spec.Metadata.Data).To(HaveKeyWithValue("commitSHA", sha))
+			Expect(res[1].Spec.Metadata.Data).To(HaveKeyWithValue("commitSHA", "c0ffee"))
+			Expect(tagRequests).To(Equal(1))
+		})
+
+		It("adds selected fields", func() {
+			Expect(discover(release.MetadataNone, "author=.author.login", "missing=.assets[0]")).To(Equal(map[string]interface{}{
+				"upgradeImage": ":v0.1.0",
+				"author":       "foo",
+			}))
+		})
+
+		It("renders names and images with templates", func() {
+			rf, err := NewReleaseFinder(
+				WithRepository("foo/bar"),
+				WithBaseURL(srv.URL),
+				WithNameTemplate(`{{.Repository}}-{{.Tag}}`),
+				WithImageTemplate(`registry/os-{{.Major}}.{{.Minor}}:{{.Tag | trimPrefix "v"}}`),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(res[0].ObjectMeta.Name).To(Equal("foo-bar-v0.1.0"))
+			Expect(res[0].Spec.Version).To(Equal("v0.1.0"))
+			Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("registry/os-0.1:0.1.0"))
+
+			_, err = NewReleaseFinder(WithImageTemplate("{{.Tag"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects invalid settings", func() {
+			_, err := NewReleaseFinder(WithMetadataProfile("foo"))
+			Expect(err).To(HaveOccurred())
+			_, err = NewReleaseFinder(WithMetadataFields("author"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("assets", func() {
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				asset := func(name, state string) map[string]interface{} {
+					return map[string]interface{}{
+						"name":                 name,
+						"state":                state,
+						"size":                 1024,
+						"content_type":         "application/octet-stream",
+						"browser_download_url": "https://github.com/foo/bar/releases/download/v0.1.0/" + name,
+					}
+				}
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{{
+					"tag_name":   "v0.1.0",
+					"prerelease": false,
+					"assets": []interface{}{
+						asset("os2-amd64.iso", "uploaded"),
+						asset("os2-arm64.iso", "uploaded"),
+						asset("os2-amd64.raw", "uploaded"),
+						asset("os2-riscv64.iso", "open"),
+					},
+				}})
+			}))
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("builds a version for each matching asset", func() {
+			rf, err := NewReleaseFinder(
+				WithRepository("foo/bar"),
+				WithBaseURL(srv.URL),
+				WithMetadataProfile(release.MetadataNone),
+				WithAssetPattern(`\.iso$`),
+				WithAssetType("iso"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+			Expect(res[0].ObjectMeta.Name).To(Equal("v0.1.0-os2-amd64.iso"))
+			Expect(res[1].ObjectMeta.Name).To(Equal("v0.1.0-os2-arm64.iso"))
+			Expect(res[0].Spec.Type).To(Equal("iso"))
+			Expect(res[0].Spec.Version).To(Equal("v0.1.0"))
+			Expect(res[0].Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"asset":       "os2-amd64.iso",
+				"downloadURL": "https://github.com/foo/bar/releases/download/v0.1.0/os2-amd64.iso",
+				"size":        1024,
+				"contentType": "application/octet-stream",
+			}))
+		})
+
+		It("names asset versions with templates", func() {
+			rf, err := NewReleaseFinder(
+				WithRepository("foo/bar"),
+				WithBaseURL(srv.URL),
+				WithAssetPattern(`amd64`),
+				WithNameTemplate(`{{.Version}}-{{.Asset | trimPrefix "os2-"}}`),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+			Expect(res[0].ObjectMeta.Name).To(Equal("v0.1.0-amd64.iso"))
+			Expect(res[1].ObjectMeta.Name).To(Equal("v0.1.0-amd64.raw"))
+			Expect(res[0].Spec.Type).To(Equal(release.ContainerType))
+			Expect(res[0].Spec.Metadata.Data).To(HaveKey("upgradeImage"))
+		})
+
+		It("rejects invalid patterns", func() {
+			_, err := NewReleaseFinder(WithRepository("foo/bar"), WithAssetPattern("("))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("manifests", func() {
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/foo/bar/releases", func(w http.ResponseWriter, req *http.Request) {
+				fence := "```"
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+					{
+						"tag_name": "v0.3.0",
+						"body":     "Upgrade notes\n\n" + fence + "yaml\nminVersion: v0.2.0\nmetadata:\n  kernelArgs: quiet\n" + fence + "\n",
+						"assets": []interface{}{
+							map[string]interface{}{"id": 1, "name": "managedosversion.yaml"},
+							map[string]interface{}{"id": 3, "name": "os2.iso", "state": "uploaded"},
+						},
+					},
+					{
+						"tag_name": "v0.2.0",
+						"body":     "Upgrade notes\n\n" + fence + "json\n{\"minVersion\": \"v0.1.0\", \"metadata\": {\"upgradeImage\": \"custom\"}}\n" + fence + "\n",
+					},
+					{
+						"tag_name": "v0.1.0",
+						"body":     fence + "yaml\nversion: v0.0.1\n" + fence + "\n",
+					},
+					{
+						"tag_name": "v0.0.1",
+						"body":     fence + "yaml\nfoo: bar\n" + fence + "\n",
+						"assets": []interface{}{
+							map[string]interface{}{"id": 2, "name": "managedosversion.yaml"},
+						},
+					},
+				})
+			})
+			mux.HandleFunc("/repos/foo/bar/releases/assets/1", func(w http.ResponseWriter, req *http.Request) {
+				http.Redirect(w, req, "/download/managedosversion.yaml", http.StatusFound)
+			})
+			mux.HandleFunc("/download/managedosversion.yaml", func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte("type: iso\nminVersion: v0.2.1\nmetadata:\n  cloudConfig: foo\n"))
+			})
+			mux.HandleFunc("/repos/foo/bar/releases/assets/2", func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte("minVersion: [v0.0.1]"))
+			})
+			srv = httptest.NewServer(mux)
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("ignores manifests by default", func() {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMetadataProfile(release.MetadataNone))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(4))
+			Expect(res[0].Spec.MinVersion).To(BeEmpty())
+		})
+
+		It("merges the release notes manifests", func() {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMetadataProfile(release.MetadataNone), WithBodyManifest(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("release 'v0.1.0': release notes manifest: version can't be set"))
+			Expect(err.Error()).To(ContainSubstring("release 'v0.0.1': release notes manifest: "))
+
+			Expect(res).To(HaveLen(2))
+			Expect(res[0].Spec.MinVersion).To(Equal("v0.2.0"))
+			Expect(res[0].Spec.Type).To(Equal(release.ContainerType))
+			Expect(res[0].Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage": ":v0.3.0",
+				"kernelArgs":   "quiet",
+			}))
+			Expect(res[1].Spec.MinVersion).To(Equal("v0.1.0"))
+			Expect(res[1].Spec.Metadata.Data["upgradeImage"]).To(Equal("custom"))
+		})
+
+		It("merges the manifest assets before the release notes", func() {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMetadataProfile(release.MetadataNone), WithBodyManifest(true), WithManifestAsset("managedosversion.yaml"))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("release 'v0.0.1': manifest asset 'managedosversion.yaml': "))
+
+			Expect(res).To(HaveLen(2))
+			Expect(res[0].Spec.Version).To(Equal("v0.3.0"))
+			Expect(res[0].Spec.MinVersion).To(Equal("v0.2.1"))
+			Expect(res[0].Spec.Type).To(Equal("iso"))
+			Expect(res[0].Spec.Metadata.Data).To(Equal(map[string]interface{}{
+				"upgradeImage": ":v0.3.0",
+				"cloudConfig":  "foo",
+			}))
+			Expect(res[1].Spec.MinVersion).To(Equal("v0.1.0"))
+		})
+
+		It("keeps the asset type of asset versions", func() {
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithMetadataProfile(release.MetadataNone),
+				WithManifestAsset("managedosversion.yaml"), WithAssetPattern(`\.iso$`), WithAssetType("raw"))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).To(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(res[0].Spec.Type).To(Equal("raw"))
+			Expect(res[0].Spec.MinVersion).To(Equal("v0.2.1"))
+			Expect(res[0].Spec.Metadata.Data["cloudConfig"]).To(Equal("foo"))
+		})
+	})
+
+	Context("filters", func() {
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			rel := func(tag, published string, prerelease, draft bool) map[string]interface{} {
+				r := map[string]interface{}{
+					"tag_name":   tag,
+					"prerelease": prerelease,
+					"draft":      draft,
+					"created_at": "2022-04-01T10:00:00Z",
+				}
+				if published != "" {
+					r["published_at"] = published
+				}
+				return r
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/foo/bar/releases", func(w http.ResponseWriter, req *http.Request) {
+				_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+					rel("v0.4.0", "", false, true),
+					rel("v0.3.0-rc1", "2022-03-15T10:00:00Z", true, false),
+					rel("v0.2.0", "2022-03-01T10:00:00Z", false, false),
+					rel("candidate/v0.2.0", "2022-02-20T10:00:00Z", false, false),
+					rel("v0.1.0", "2022-01-01T10:00:00Z", false, false),
+				})
+			})
+			mux.HandleFunc("/repos/foo/bar/releases/latest", func(w http.ResponseWriter, req *http.Request) {
+				_ = json.NewEncoder(w).Encode(rel("v0.2.0", "2022-03-01T10:00:00Z", false, false))
+			})
+			srv = httptest.NewServer(mux)
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("skips drafts and pre-releases by default", func() {
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL)))).To(WithTransform(discoverytest.Versions, Equal([]string{"v0.2.0", "candidate/v0.2.0", "v0.1.0"})))
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithDrafts(true), WithPreReleases(true)))).To(WithTransform(discoverytest.Versions, HaveLen(5)))
+		})
+
+		It("only includes the latest release", func() {
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithLatestOnly(true)))).To(WithTransform(discoverytest.Versions, Equal([]string{"v0.2.0"})))
+		})
+
+		It("filters releases by publication date", func() {
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithPublishedAfter("2022-02-01"), WithPublishedBefore("2022-03-01T10:00:00Z")))).To(WithTransform(discoverytest.Versions, Equal([]string{"candidate/v0.2.0"})))
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithDrafts(true), WithPublishedAfter("2022-03-20")))).To(WithTransform(discoverytest.Versions, Equal([]string{"v0.4.0"})))
+
+			_, err := NewReleaseFinder(WithPublishedAfter("yesterday"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("filters releases by tag", func() {
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithTagPattern("^candidate/")))).To(WithTransform(discoverytest.Versions, Equal([]string{"candidate/v0.2.0"})))
+			Expect(discoverytest.Discover(NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithTagConstraint(">=v0.2.0")))).To(WithTransform(discoverytest.Versions, Equal([]string{"v0.2.0"})))
+		})
+	})
+
+	Context("authentication", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "github-auth")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		// authorized serves the releases to requests with the given token
+		authorized := func(token string) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Authorization") != "Bearer "+token {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				releasesHandler("v0.1.0")(w, req)
+			}
+		}
+
+		It("reads the token from a file", func() {
+			srv := httptest.NewServer(authorized("secret"))
+			defer srv.Close()
+
+			tokenFile := filepath.Join(dir, "token")
+			Expect(ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600)).To(Succeed())
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithTokenFile(tokenFile))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+
+			_, err = NewReleaseFinder(WithTokenFile(filepath.Join(dir, "missing")))
+			Expect(err).To(HaveOccurred())
+			_, err = NewReleaseFinder(WithTokenFile(tokenFile), WithToken("secret"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("authenticates as a Github App installation", func() {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).ToNot(HaveOccurred())
+			keyFile := filepath.Join(dir, "app.pem")
+			Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			}), 0600)).To(Succeed())
+
+			issued := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+				parts := strings.Split(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), ".")
+				Expect(parts).To(HaveLen(3))
+				sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+				Expect(err).ToNot(HaveOccurred())
+				digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+				Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)).To(Succeed())
+
+				dat, err := base64.RawURLEncoding.DecodeString(parts[1])
+				Expect(err).ToNot(HaveOccurred())
+				claims := map[string]int64{}
+				Expect(json.Unmarshal(dat, &claims)).To(Succeed())
+				Expect(claims["iss"]).To(Equal(int64(7)))
+				Expect(claims["exp"] - claims["iat"]).To(BeNumerically("<=", 600))
+
+				issued++
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"token":      "installation-token",
+					"expires_at": time.Now().Add(time.Hour),
+				})
+			})
+			mux.Handle("/repos/foo/bar/releases", authorized("installation-token"))
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithApp(7, 42, keyFile))
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 2; i++ {
+				res, err := rf.Discovery()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res).To(HaveLen(1))
+			}
+			Expect(issued).To(Equal(1))
+
+			_, err = NewReleaseFinder(WithApp(7, 0, keyFile))
+			Expect(err).To(HaveOccurred())
+			_, err = NewReleaseFinder(WithApp(7, 42, filepath.Join(dir, "missing")))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("caches the responses of Github App installations", func() {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).ToNot(HaveOccurred())
+			keyFile := filepath.Join(dir, "app.pem")
+			Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(key),
+			}), 0600)).To(Succeed())
+
+			issued, notModified, minting := 0, 0, true
+			mux := http.NewServeMux()
+			mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+				if !minting {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				issued++
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"token":      fmt.Sprintf("installation-token-%d", issued),
+					"expires_at": time.Now().Add(time.Hour),
+				})
+			})
+			mux.HandleFunc("/repos/foo/bar/releases", func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Authorization") != fmt.Sprintf("Bearer installation-token-%d", issued) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if req.Header.Get("If-None-Match") == `"releases"` {
+					notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", `"releases"`)
+				releasesHandler("v0.1.0")(w, req)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			cache := filepath.Join(dir, "cache")
+			for i := 0; i < 3; i++ {
+				if i == 2 {
+					minting = false
+				}
+				rf, err := NewReleaseFinder(WithRepository("foo/bar"), WithBaseURL(srv.URL), WithApp(7, 42, keyFile), WithCacheDir(cache), WithRateLimitTimeout(0))
+				Expect(err).ToNot(HaveOccurred())
+				res, err := rf.Discovery()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res).To(HaveLen(1))
+			}
+			Expect(issued).To(Equal(2))
+			Expect(notModified).To(Equal(1))
+		})
+	})
 
 	Context("discovery", func() {
 		It("fails if there aren't enough information", func() {
@@ -77,6 +883,20 @@ var _ = Describe("github discovery", func() {
 			Expect(versions).Should(ContainElement(ContainSubstring("rc1")))
 		})
 
+		It("fails with a negative releases cap", func() {
+			_, err := NewReleaseFinder(WithMaxReleases(-1))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("caps the number of releases", func() {
+			rf, err := NewReleaseFinder(WithRepository("rancher-sandbox/os2"), WithPreReleases(true), WithMaxReleases(2))
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(2))
+		})
+
 		It("manipulates releases results", func() {
 			rf, err := NewReleaseFinder(
 				WithRepository("rancher-sandbox/os2"),
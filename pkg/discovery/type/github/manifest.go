@@ -0,0 +1,151 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	"github.com/google/go-github/github"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher/fleet/pkg/apis/fleet.cattle.io/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// maxManifestSize is the maximum size of the manifest assets
+const maxManifestSize = 1 << 20
+
+// fencedBlock matches a fenced YAML or JSON code block of a Markdown text
+var fencedBlock = regexp.MustCompile("(?ms)^```[ \t]*(?:ya?ml|json)[ \t]*\r?\n(.*?)^```")
+
+// manifest returns the ManagedOSVersion spec the release provides in its manifest asset or its release notes,
+// nil if it has none
+func (f *releaseFinder) manifest(owner, name string, r *github.RepositoryRelease) (*provv1.ManagedOSVersionSpec, error) {
+	if f.opts.manifestAsset != "" {
+		for _, a := range r.Assets {
+			if a.GetName() != f.opts.manifestAsset {
+				continue
+			}
+			dat, err := f.downloadAsset(owner, name, a.GetID())
+			if err != nil {
+				return nil, fmt.Errorf("manifest asset '%s': %w", a.GetName(), err)
+			}
+			spec, err := parseManifest(dat)
+			if err != nil {
+				return nil, fmt.Errorf("manifest asset '%s': %w", a.GetName(), err)
+			}
+			return spec, nil
+		}
+	}
+
+	if !f.opts.bodyManifest {
+		return nil, nil
+	}
+	m := fencedBlock.FindStringSubmatch(r.GetBody())
+	if m == nil {
+		return nil, nil
+	}
+	spec, err := parseManifest([]byte(m[1]))
+	if err != nil {
+		return nil, fmt.Errorf("release notes manifest: %w", err)
+	}
+	return spec, nil
+}
+
+// downloadAsset returns the content of a release asset, following the redirect to its storage if any
+func (f *releaseFinder) downloadAsset(owner, name string, id int64) ([]byte, error) {
+	var rc io.ReadCloser
+	_, err := f.withRateLimit(func() (*github.Response, error) {
+		var redirect string
+		var err error
+		rc, redirect, err = f.api.Repositories.DownloadReleaseAsset(f.opts.ctx, owner, name, id)
+		if err != nil || rc != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(f.opts.ctx, http.MethodGet, redirect, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := f.download.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status downloading '%s': %s", redirect, resp.Status)
+		}
+		rc = resp.Body
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	dat, err := ioutil.ReadAll(io.LimitReader(rc, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxManifestSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxManifestSize)
+	}
+	return dat, nil
+}
+
+// parseManifest decodes a YAML or JSON ManagedOSVersion spec, rejecting unknown fields. The version is set
+// by the release and can't be changed by the manifest.
+func parseManifest(dat []byte) (*provv1.ManagedOSVersionSpec, error) {
+	spec := &provv1.ManagedOSVersionSpec{}
+	if err := yaml.UnmarshalStrict(dat, spec); err != nil {
+		return nil, err
+	}
+	if spec.Version != "" {
+		return nil, errors.New("version can't be set by the manifest")
+	}
+	return spec, nil
+}
+
+// mergeManifest sets the fields of the manifest on the version, adding the metadata keys to its metadata.
+// The type isn't set with keepType, so versions built from release assets keep the configured asset type.
+func mergeManifest(v *provv1.ManagedOSVersion, spec *provv1.ManagedOSVersionSpec, keepType bool) {
+	if spec == nil {
+		return
+	}
+	if spec.Type != "" && !keepType {
+		v.Spec.Type = spec.Type
+	}
+	if spec.MinVersion != "" {
+		v.Spec.MinVersion = spec.MinVersion
+	}
+	if spec.UpgradeContainer != nil {
+		v.Spec.UpgradeContainer = spec.UpgradeContainer.DeepCopy()
+	}
+	if spec.Metadata == nil {
+		return
+	}
+	if v.Spec.Metadata == nil {
+		v.Spec.Metadata = &v1alpha1.GenericMap{Data: map[string]interface{}{}}
+	}
+	for k, val := range spec.Metadata.Data {
+		v.Spec.Metadata.Data[k] = val
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+)
+
+// metadata returns the release data added to the version metadata, according to the metadata profile.
+// The fields picked by the metadata selectors are added on top of it.
+func (f *releaseFinder) metadata(r *github.RepositoryRelease, commits map[string]string) (map[string]interface{}, error) {
+	res, err := release.SelectMetadata(r, f.opts.metadataFields)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := map[string]interface{}{}
+	switch f.opts.metadataProfile {
+	case release.MetadataFull:
+		profile["github_data"] = r
+	case release.MetadataCurated:
+		profile["tag"] = r.GetTagName()
+		profile["prerelease"] = r.GetPrerelease()
+		if u := r.GetHTMLURL(); u != "" {
+			profile["releaseURL"] = u
+		}
+		if t := r.GetPublishedAt(); !t.IsZero() {
+			profile["publishedAt"] = t.UTC().Format(time.RFC3339)
+		}
+		if sha, ok := commits[r.GetTagName()]; ok {
+			profile["commitSHA"] = sha
+		}
+	}
+
+	for k, v := range profile {
+		if _, ok := res[k]; !ok {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// commitSHA matches the release targets which are commits rather than branches
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// tagCommits returns the SHA of the commit the tag of each release points to. The commits targeted by the
+// releases are used as is, the other tags are looked up in the tags list until they're all found.
+func (f *releaseFinder) tagCommits(owner, name string, rels []*github.RepositoryRelease) (map[string]string, error) {
+	res := map[string]string{}
+	missing := map[string]bool{}
+	for _, r := range rels {
+		if target := r.GetTargetCommitish(); commitSHA.MatchString(target) {
+			res[r.GetTagName()] = target
+		} else {
+			missing[r.GetTagName()] = true
+		}
+	}
+
+	opts := &github.ListOptions{PerPage: perPage}
+	for len(missing) > 0 {
+		page, resp, err := f.listTags(owner, name, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page {
+			if missing[t.GetName()] {
+				res[t.GetName()] = t.GetCommit().GetSHA()
+				delete(missing, t.GetName())
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return res, nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRateLimitTimeout is how long the discovery waits for rate limits to reset by default
+	DefaultRateLimitTimeout = 5 * time.Minute
+
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	// the quota is low below a tenth of the limit
+	lowQuotaRatio = 10
+)
+
+// withRateLimit calls the API, waiting for the rate limits to reset and retrying
+// until the rate limit timeout or the context deadline
+func (f *releaseFinder) withRateLimit(call func() (*github.Response, error)) (*github.Response, error) {
+	deadline := time.Now().Add(f.opts.rateLimitTimeout)
+	if d, ok := f.opts.ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	backoff := minBackoff
+	for {
+		res, err := call()
+		if res != nil && res.Rate.Limit > 0 {
+			f.rate = res.Rate
+		}
+
+		wait, limited := rateLimitWait(err, res, backoff)
+		if !limited {
+			return res, err
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return res, fmt.Errorf("rate limit not reset before the %s timeout: %w", f.opts.rateLimitTimeout, err)
+		}
+
+		log.Printf("Github API rate limit exceeded, retrying in %s", wait)
+		select {
+		case <-f.opts.ctx.Done():
+			return res, f.opts.ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// listReleases lists a page of releases, waiting for the rate limits to reset
+func (f *releaseFinder) listReleases(owner, name string, opts *github.ListOptions) (page []*github.RepositoryRelease, res *github.Response, err error) {
+	res, err = f.withRateLimit(func() (res *github.Response, err error) {
+		page, res, err = f.api.Repositories.ListReleases(f.opts.ctx, owner, name, opts)
+		return
+	})
+	return
+}
+
+// listTags lists a page of tags, waiting for the rate limits to reset
+func (f *releaseFinder) listTags(owner, name string, opts *github.ListOptions) (page []*github.RepositoryTag, res *github.Response, err error) {
+	res, err = f.withRateLimit(func() (res *github.Response, err error) {
+		page, res, err = f.api.Repositories.ListTags(f.opts.ctx, owner, name, opts)
+		return
+	})
+	return
+}
+
+// rateLimitWait returns how long to wait before retrying a request which hit a rate limit, and whether it did
+func rateLimitWait(err error, res *github.Response, backoff time.Duration) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		return untilReset(rateErr.Rate.Reset.Time, backoff), true
+	case errors.As(err, &abuseErr):
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return backoff, true
+	case err == nil || res == nil:
+		return 0, false
+	}
+
+	// Secondary rate limits aren't all recognized by the client, they're
+	// answered with a Retry-After header or an exhausted quota
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if s := res.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		return untilReset(res.Rate.Reset.Time, backoff), true
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return backoff, true
+	}
+	return 0, false
+}
+
+// untilReset returns the time left until the rate limit reset, or the backoff if it's already reset
+func untilReset(reset time.Time, backoff time.Duration) time.Duration {
+	wait := time.Until(reset)
+	if wait <= 0 {
+		return backoff
+	}
+	// The reset time has a second precision
+	return wait + time.Second
+}
+
+// logQuota logs the quota left after the last request of a discovery, as a warning when it runs low
+func (f *releaseFinder) logQuota() {
+	r := f.rate
+	if r.Limit == 0 {
+		return
+	}
+	logf := logrus.Debugf
+	if r.Remaining*lowQuotaRatio < r.Limit {
+		logf = logrus.Warnf
+	}
+	logf("Github API quota: %d of %d requests remaining, reset at %s", r.Remaining, r.Limit, r.Reset.Format(time.RFC3339))
+}
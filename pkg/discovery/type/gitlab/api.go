@@ -0,0 +1,141 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+)
+
+// perPage is the maximum page size allowed by the GitLab API
+const perPage = 100
+
+// gitlabRelease holds the fields of a GitLab release used to build versions
+type gitlabRelease struct {
+	TagName         string `json:"tag_name"`
+	Name            string `json:"name"`
+	UpcomingRelease bool   `json:"upcoming_release"`
+}
+
+// releasesURL returns the URL of a page of the project releases
+func releasesURL(o release.ForgeOptions, page, size int) string {
+	q := url.Values{}
+	q.Set("per_page", strconv.Itoa(size))
+	q.Set("page", strconv.Itoa(page))
+	return fmt.Sprintf("%s/api/v4/projects/%s/releases?%s", o.BaseURL, url.PathEscape(o.Repository), q.Encode())
+}
+
+// Releases returns the releases of the project, the upcoming ones being pre-releases
+func (a *api) Releases(o release.ForgeOptions) ([]release.ForgeRelease, error) {
+	if o.Repository == "" {
+		return nil, errors.New("no GitLab project set")
+	}
+
+	var rels []release.ForgeRelease
+	size := perPage
+	if o.MaxReleases > 0 && o.MaxReleases < perPage {
+		size = o.MaxReleases
+	}
+
+	for page := 1; page != 0; {
+		res, next, err := a.listReleases(o, page, size)
+		if err != nil {
+			return nil, err
+		}
+
+		rels = append(rels, res...)
+		if o.MaxReleases > 0 && len(rels) >= o.MaxReleases {
+			return rels[:o.MaxReleases], nil
+		}
+		page = next
+	}
+	return rels, nil
+}
+
+// listReleases returns a page of releases along with the number of the next page, 0 on the last one
+func (a *api) listReleases(o release.ForgeOptions, page, size int) ([]release.ForgeRelease, int, error) {
+	req, err := http.NewRequestWithContext(o.Ctx, http.MethodGet, releasesURL(o, page, size), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if o.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", o.Token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// 404 means project not found or not visible with the token. It's not an error here.
+		log.Printf("API returned 404. Project '%s' not found", o.Repository)
+		return nil, 0, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, 0, fmt.Errorf("GET %s: %s: %s", req.URL.Redacted(), resp.Status, errorMessage(resp.Body))
+	}
+
+	var raw []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, 0, fmt.Errorf("decoding releases: %w", err)
+	}
+
+	rels := make([]release.ForgeRelease, len(raw))
+	for i, r := range raw {
+		var rel gitlabRelease
+		if err := json.Unmarshal(r, &rel); err != nil {
+			return nil, 0, fmt.Errorf("decoding releases: %w", err)
+		}
+		rels[i] = release.ForgeRelease{Tag: rel.TagName, Name: rel.Name, Prerelease: rel.UpcomingRelease}
+		if err := json.Unmarshal(r, &rels[i].Data); err != nil {
+			return nil, 0, fmt.Errorf("decoding releases: %w", err)
+		}
+	}
+
+	next, _ := strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	return rels, next, nil
+}
+
+// errorMessage returns the message of a GitLab API error response, or its raw body
+func errorMessage(body io.Reader) string {
+	dat, _ := ioutil.ReadAll(io.LimitReader(body, 4096))
+	var e struct {
+		Message interface{} `json:"message"`
+		Error   string      `json:"error"`
+	}
+	if json.Unmarshal(dat, &e) == nil {
+		if e.Message != nil {
+			return fmt.Sprint(e.Message)
+		}
+		if e.Error != "" {
+			return e.Error
+		}
+	}
+	return string(dat)
+}
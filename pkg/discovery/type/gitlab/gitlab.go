@@ -0,0 +1,59 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+)
+
+// DefaultBaseURL is the URL of gitlab.com, used unless the URL of a self-managed instance is set
+const DefaultBaseURL = "https://gitlab.com"
+
+// The settings of the GitLab release finder, shared with the other forges.
+// The repository is a project path (e.g. group/subgroup/os) or ID, the token a personal, project or group
+// access token, and the pre-releases are the upcoming releases, whose release date is in the future.
+var (
+	WithRepository         = release.WithRepository
+	WithContext            = release.WithContext
+	WithToken              = release.WithToken
+	WithBaseURL            = release.WithBaseURL
+	WithBaseImage          = release.WithBaseImage
+	WithVersionNamePrefix  = release.WithVersionNamePrefix
+	WithVersionNameSuffix  = release.WithVersionNameSuffix
+	WithVersionPrefix      = release.WithVersionPrefix
+	WithVersionSuffix      = release.WithVersionSuffix
+	WithPreReleases        = release.WithPreReleases
+	WithMaxReleases        = release.WithMaxReleases
+	WithDigestPinning      = release.WithDigestPinning
+	WithMissingImagePolicy = release.WithMissingImagePolicy
+	WithRegistryAuth       = release.WithRegistryAuth
+	WithRegistryToken      = release.WithRegistryToken
+	WithRegistryPlainHTTP  = release.WithRegistryPlainHTTP
+)
+
+// api lists the releases of a project through the GitLab REST API
+type api struct {
+	client *http.Client
+}
+
+// NewReleaseFinder returns a new GitLab release finder discovery with the required settings
+func NewReleaseFinder(opts ...release.ForgeSetting) (*release.ForgeFinder, error) {
+	return release.NewForgeFinder("gitlab", &api{client: &http.Client{Timeout: 30 * time.Second}}, DefaultBaseURL, opts...)
+}
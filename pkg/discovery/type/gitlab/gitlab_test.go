@@ -0,0 +1,180 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitlab_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/gitlab"
+)
+
+// releasesHandler serves releases for the given tags like the GitLab API, paginated with page and per_page.
+// Tags ending with -rc are upcoming releases.
+func releasesHandler(tags ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		if perPage == 0 {
+			perPage = 20
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		start := (page - 1) * perPage
+		if start > len(tags) {
+			start = len(tags)
+		}
+		end := start + perPage
+		if end < len(tags) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			end = len(tags)
+			w.Header().Set("X-Next-Page", "")
+		}
+
+		rels := []map[string]interface{}{}
+		for _, t := range tags[start:end] {
+			rels = append(rels, map[string]interface{}{
+				"tag_name":         t,
+				"name":             "Release " + t,
+				"upcoming_release": len(t) > 3 && t[len(t)-3:] == "-rc",
+				"_links":           map[string]interface{}{"self": "https://gitlab.example.com/os/os2/-/releases/" + t},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rels)
+	}
+}
+
+var _ = Describe("gitlab discovery", func() {
+	var srv *httptest.Server
+	var tags []string
+	var token string
+
+	BeforeEach(func() {
+		tags = []string{"v0.3.0-rc", "v0.2.0", "v0.1.0"}
+		token = ""
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.EscapedPath() != "/api/v4/projects/os%2Fos2/releases" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"message": "404 Project Not Found"}`))
+				return
+			}
+			if token != "" && req.Header.Get("PRIVATE-TOKEN") != token {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"message": "401 Unauthorized"}`))
+				return
+			}
+			releasesHandler(tags...)(w, req)
+		})
+		srv = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("fails if there aren't enough information", func() {
+		rf, err := NewReleaseFinder(WithBaseURL(srv.URL))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewReleaseFinder(WithBaseURL("gitlab.example.com"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("detect releases", func() {
+		rf, err := NewReleaseFinder(
+			WithRepository("os/os2"),
+			WithBaseURL(srv.URL+"/"),
+			WithBaseImage("registry.example.com/os/os2"),
+			WithVersionPrefix("foo-"),
+			WithVersionNameSuffix("-amd64"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Versions(res)).To(Equal([]string{"foo-v0.2.0", "foo-v0.1.0"}))
+		Expect(res[0].ObjectMeta.Name).To(Equal("foo-v0.2.0-amd64"))
+		Expect(res[0].Spec.Type).To(Equal("container"))
+		Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal("registry.example.com/os/os2:foo-v0.2.0"))
+		Expect(res[0].Spec.Metadata.Data["gitlab_data"]).To(HaveKeyWithValue("name", "Release v0.2.0"))
+	})
+
+	It("includes upcoming releases if set", func() {
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithPreReleases(true))
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Versions(res)).To(Equal([]string{"v0.3.0-rc", "v0.2.0", "v0.1.0"}))
+	})
+
+	It("walks all the pages", func() {
+		tags = nil
+		for i := 0; i < 250; i++ {
+			tags = append(tags, fmt.Sprintf("v0.%d.0", i))
+		}
+
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(250))
+		Expect(res[249].Spec.Version).To(Equal("v0.249.0"))
+
+		rf, err = NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithMaxReleases(120))
+		Expect(err).ToNot(HaveOccurred())
+		res, err = rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(120))
+	})
+
+	It("authenticates with a token", func() {
+		token = "secret"
+
+		rf, err := NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("401 Unauthorized")))
+
+		rf, err = NewReleaseFinder(WithRepository("os/os2"), WithBaseURL(srv.URL), WithToken("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+	})
+
+	It("returns no releases for unknown projects", func() {
+		rf, err := NewReleaseFinder(WithRepository("os/foo"), WithBaseURL(srv.URL))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(BeEmpty())
+	})
+})
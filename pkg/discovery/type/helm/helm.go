@@ -0,0 +1,335 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+)
+
+// ociScheme prefixes the OCI chart repositories
+const ociScheme = "oci://"
+
+type helmOptions struct {
+	naming            release.Naming
+	repository        string
+	chart             string
+	versions          release.TagFilter
+	username          string
+	password          string
+	token             string
+	plainHTTP         bool
+	digestPinning     bool
+	missingImages     release.MissingImagePolicy
+	registryUsername  string
+	registryPassword  string
+	registryToken     string
+	registryPlainHTTP bool
+	ctx               context.Context
+}
+
+type helmSetting func(h *helmOptions) error
+
+// WithRepository sets the chart repository: the URL of an HTTP(S) repository or of its index.yaml, the path of
+// a local index.yaml or of its directory, or an OCI repository prefixed by oci://, e.g. oci://ghcr.io/os/charts
+func WithRepository(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.repository = s
+		return nil
+	}
+}
+
+// WithChart sets the name of the chart to list the versions of
+func WithChart(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.chart = s
+		return nil
+	}
+}
+
+// WithContext sets a context for the discovery action
+func WithContext(ctx context.Context) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.ctx = ctx
+		return nil
+	}
+}
+
+// WithChartConstraint only includes the chart versions satisfying the given semver constraint
+func WithChartConstraint(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		return h.versions.SetConstraint(s)
+	}
+}
+
+// WithBasicAuth sets the credentials used against the chart repository
+func WithBasicAuth(username, password string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.username = username
+		h.password = password
+		return nil
+	}
+}
+
+// WithToken sets a bearer token used against the chart repository
+func WithToken(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.token = s
+		return nil
+	}
+}
+
+// WithPlainHTTP talks to an OCI chart repository over plain HTTP instead of HTTPS
+func WithPlainHTTP(value bool) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.plainHTTP = value
+		return nil
+	}
+}
+
+// WithBaseImage sets the image repository the app versions are appended to as a tag
+func WithBaseImage(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.naming.BaseImage = s
+		return nil
+	}
+}
+
+// WithVersionNamePrefix adds a prefix to the created ManagedOSVersion resource
+func WithVersionNamePrefix(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.naming.NamePrefix = s
+		return nil
+	}
+}
+
+// WithVersionNameSuffix appends a suffix to the created ManagedOSVersion resource
+func WithVersionNameSuffix(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.naming.NameSuffix = s
+		return nil
+	}
+}
+
+// WithVersionPrefix adds a prefix to the chart version
+func WithVersionPrefix(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.naming.VersionPrefix = s
+		return nil
+	}
+}
+
+// WithVersionSuffix appends a suffix to the chart version
+func WithVersionSuffix(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.naming.VersionSuffix = s
+		return nil
+	}
+}
+
+// WithVersionTemplate renders the versions with a Go template instead of adding the version prefix and suffix to the chart version
+func WithVersionTemplate(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		return h.naming.SetVersionTemplate(s)
+	}
+}
+
+// WithNameTemplate renders the ManagedOSVersion names with a Go template, sanitized to be valid Kubernetes names
+func WithNameTemplate(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		return h.naming.SetNameTemplate(s)
+	}
+}
+
+// WithImageTemplate renders the upgrade images with a Go template instead of tagging the base image with the app version
+func WithImageTemplate(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		return h.naming.SetImageTemplate(s)
+	}
+}
+
+// WithDigestPinning resolves the upgrade images against the registry and pins them to their digest
+func WithDigestPinning(value bool) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.digestPinning = value
+		return nil
+	}
+}
+
+// WithMissingImagePolicy sets how versions whose upgrade image doesn't exist are handled when pinning digests
+func WithMissingImagePolicy(p release.MissingImagePolicy) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		if p == "" {
+			return nil
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		h.missingImages = p
+		return nil
+	}
+}
+
+// WithRegistryAuth sets the credentials used against the image registry when pinning digests
+func WithRegistryAuth(username, password string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.registryUsername = username
+		h.registryPassword = password
+		return nil
+	}
+}
+
+// WithRegistryToken sets a bearer token used against the image registry when pinning digests
+func WithRegistryToken(s string) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.registryToken = s
+		return nil
+	}
+}
+
+// WithRegistryPlainHTTP talks to the image registry over plain HTTP when pinning digests
+func WithRegistryPlainHTTP(value bool) helmSetting { //nolint:golint,revive
+	return func(h *helmOptions) error {
+		h.registryPlainHTTP = value
+		return nil
+	}
+}
+
+func (h *helmOptions) apply(opts ...helmSetting) error {
+	for _, o := range opts {
+		if err := o(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type releaseFinder struct {
+	client   *http.Client
+	charts   *oci.Client
+	registry *oci.Client
+	opts     helmOptions
+}
+
+// NewReleaseFinder returns a new Helm chart finder discovery with the required settings
+func NewReleaseFinder(opts ...helmSetting) (*releaseFinder, error) { //nolint:golint,revive
+	o := &helmOptions{
+		ctx:           context.Background(),
+		missingImages: release.MissingImageDrop,
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	o.naming.Repository = o.repository
+
+	charts, err := oci.NewClient(
+		oci.WithContext(o.ctx),
+		oci.WithBasicAuth(o.username, o.password),
+		oci.WithToken(o.token),
+		oci.WithPlainHTTP(o.plainHTTP),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := oci.NewClient(
+		oci.WithContext(o.ctx),
+		oci.WithBasicAuth(o.registryUsername, o.registryPassword),
+		oci.WithToken(o.registryToken),
+		oci.WithPlainHTTP(o.registryPlainHTTP),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &releaseFinder{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		charts:   charts,
+		registry: reg,
+		opts:     *o,
+	}, nil
+}
+
+// String identifies the finder in the discovery errors
+func (f *releaseFinder) String() string {
+	return "helm:" + strings.TrimSuffix(f.opts.repository, "/") + "/" + f.opts.chart
+}
+
+// chartVersion is a version of a chart, as listed in the repository index or in the config of an OCI chart
+type chartVersion struct {
+	Name       string `json:"name" yaml:"name"`
+	Version    string `json:"version" yaml:"version"`
+	AppVersion string `json:"appVersion" yaml:"appVersion"`
+	Digest     string `json:"digest,omitempty" yaml:"digest"`
+}
+
+// Discovery retrieves ManagedOSVersion from the versions of a Helm chart.
+// Versions which can't be built are reported in the returned error, along with the valid ones.
+func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	switch {
+	case f.opts.repository == "":
+		return nil, errors.New("no chart repository set")
+	case f.opts.chart == "":
+		return nil, errors.New("no chart set")
+	}
+
+	var charts []chartVersion
+	if strings.HasPrefix(f.opts.repository, ociScheme) {
+		charts, err = f.ociVersions()
+	} else {
+		charts, err = f.indexVersions()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var errs *multierror.Error
+	for _, c := range charts {
+		metadata := map[string]interface{}{
+			"chart":        f.opts.chart,
+			"chartVersion": c.Version,
+			"appVersion":   c.AppVersion,
+		}
+		if c.Digest != "" {
+			metadata["chartDigest"] = c.Digest
+		}
+		v, err := f.opts.naming.ChartVersion(c.Version, c.AppVersion, metadata)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		res = append(res, v)
+	}
+
+	if f.opts.digestPinning {
+		res, err = release.PinDigests(f.registry, res, f.opts.missingImages)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return res, errs.ErrorOrNil()
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/helm"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci/ocitest"
+)
+
+const repoIndex = `apiVersion: v1
+entries:
+  os2:
+  - name: os2
+    version: 1.2.0
+    appVersion: v0.5.0
+    digest: 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae
+    urls:
+    - os2-1.2.0.tgz
+  - name: os2
+    version: 1.1.0
+    appVersion: 1.10
+  - name: os2
+    version: 1.0.0
+  - name: os2
+    version: 0.9.0
+    appVersion: v0.1.0
+  other:
+  - name: other
+    version: 2.0
+    appVersion: v2.0.0
+`
+
+func images(versions []*provv1.ManagedOSVersion) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, v := range versions {
+		res[v.ObjectMeta.Name] = v.Spec.Metadata.Data["upgradeImage"]
+	}
+	return res
+}
+
+var _ = Describe("helm discovery", func() {
+	It("fails if there aren't enough information", func() {
+		_, err := discoverytest.Discover(NewReleaseFinder(WithChart("os2")))
+		Expect(err).To(HaveOccurred())
+		_, err = discoverytest.Discover(NewReleaseFinder(WithRepository("https://charts.example.com")))
+		Expect(err).To(HaveOccurred())
+		_, err = NewReleaseFinder(WithChartConstraint("not a constraint"))
+		Expect(err).To(HaveOccurred())
+		_, err = NewReleaseFinder(WithImageTemplate("{{.AppVersion"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("repository index", func() {
+		var srv *httptest.Server
+
+		BeforeEach(func() {
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if user, pass, ok := req.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if req.URL.Path != "/charts/index.yaml" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(repoIndex))
+			}))
+		})
+
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		It("builds versions from the chart versions of the index", func() {
+			res, err := discoverytest.Discover(NewReleaseFinder(
+				WithRepository(srv.URL+"/charts/"),
+				WithChart("os2"),
+				WithBasicAuth("foo", "bar"),
+				WithBaseImage("quay.io/costoolkit/os2"),
+				WithChartConstraint(">=1.1.0"),
+				WithVersionNamePrefix("os2-"),
+			))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(images(res)).To(Equal(map[string]interface{}{
+				"os2-1.2.0": "quay.io/costoolkit/os2:v0.5.0",
+				"os2-1.1.0": "quay.io/costoolkit/os2:1.10",
+			}))
+			Expect(res[0].Spec.Version).To(Equal("1.2.0"))
+			Expect(res[0].Spec.Metadata.Data).To(HaveKeyWithValue("appVersion", "v0.5.0"))
+			Expect(res[0].Spec.Metadata.Data).To(HaveKeyWithValue("chartDigest", "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"))
+
+			_, err = discoverytest.Discover(NewReleaseFinder(WithRepository(srv.URL+"/charts/index.yaml"), WithChart("missing"), WithBasicAuth("foo", "bar")))
+			Expect(err).To(MatchError(ContainSubstring("chart 'missing' not found")))
+
+			_, err = discoverytest.Discover(NewReleaseFinder(WithRepository(srv.URL+"/charts"), WithChart("os2")))
+			Expect(err).To(MatchError(ContainSubstring("401")))
+		})
+
+		It("reports the versions without appVersion", func() {
+			res, err := discoverytest.Discover(NewReleaseFinder(
+				WithRepository(srv.URL+"/charts/index.yaml"),
+				WithChart("os2"),
+				WithBasicAuth("foo", "bar"),
+				WithBaseImage("quay.io/costoolkit/os2"),
+			))
+			Expect(err).To(MatchError(ContainSubstring("chart version '1.0.0': no appVersion set")))
+			Expect(res).To(HaveLen(3))
+		})
+
+		It("renders images with templates", func() {
+			res, err := discoverytest.Discover(NewReleaseFinder(
+				WithRepository(srv.URL+"/charts"),
+				WithChart("os2"),
+				WithBasicAuth("foo", "bar"),
+				WithChartConstraint("~1.2"),
+				WithImageTemplate(`registry.example.com/os2-{{.Major}}:{{.AppVersion | trimPrefix "v"}}`),
+			))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(images(res)).To(Equal(map[string]interface{}{
+				"1.2.0": "registry.example.com/os2-1:0.5.0",
+			}))
+		})
+	})
+
+	It("reads local indexes", func() {
+		dir, err := os.MkdirTemp("", "helm")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "index.yaml"), []byte(repoIndex), 0600)).To(Succeed())
+
+		for _, repo := range []string{dir, filepath.Join(dir, "index.yaml")} {
+			res, err := discoverytest.Discover(NewReleaseFinder(WithRepository(repo), WithChart("other"), WithBaseImage("foo/other")))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(images(res)).To(Equal(map[string]interface{}{"2.0": "foo/other:v2.0.0"}))
+		}
+	})
+
+	It("fails on malformed indexes", func() {
+		dir, err := os.MkdirTemp("", "helm")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "index.yaml"), []byte("0: [:!00 \xef"), 0600)).To(Succeed())
+
+		_, err = discoverytest.Discover(NewReleaseFinder(WithRepository(dir), WithChart("os2")))
+		Expect(err).To(MatchError(ContainSubstring("invalid repository index")))
+	})
+
+	Context("OCI repository", func() {
+		var reg *ocitest.Registry
+
+		BeforeEach(func() {
+			reg = ocitest.NewRegistry()
+			reg.Username, reg.Password, reg.TokenAuth = "foo", "bar", true
+			reg.PushArtifact("charts/os2", "1.0.0", ConfigMediaType, []byte(`{"name": "os2", "version": "1.0.0", "appVersion": "v0.1.0"}`))
+			reg.PushArtifact("charts/os2", "1.1.0_build.1", ConfigMediaType, []byte(`{"name": "os2", "version": "1.1.0+build.1", "appVersion": "v0.2.0"}`))
+			reg.Push("charts/os2", "0.1.0")
+		})
+
+		AfterEach(func() {
+			reg.Close()
+		})
+
+		It("reads the app versions of the chart configs", func() {
+			res, err := discoverytest.Discover(NewReleaseFinder(
+				WithRepository("oci://"+reg.Host()+"/charts"),
+				WithChart("os2"),
+				WithBasicAuth("foo", "bar"),
+				WithPlainHTTP(true),
+				WithBaseImage("quay.io/costoolkit/os2"),
+				WithChartConstraint(">=1.0.0"),
+			))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(images(res)).To(Equal(map[string]interface{}{
+				"1.0.0":         "quay.io/costoolkit/os2:v0.1.0",
+				"1.1.0+build.1": "quay.io/costoolkit/os2:v0.2.0",
+			}))
+		})
+
+		It("fails on artifacts which are not charts", func() {
+			_, err := discoverytest.Discover(NewReleaseFinder(
+				WithRepository("oci://"+reg.Host()+"/charts"),
+				WithChart("os2"),
+				WithBasicAuth("foo", "bar"),
+				WithPlainHTTP(true),
+			))
+			Expect(err).To(MatchError(ContainSubstring("is not a Helm chart")))
+		})
+	})
+})
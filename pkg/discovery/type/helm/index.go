@@ -0,0 +1,121 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxIndexSize is the maximum size of the repository index, the ones of the big public repositories being
+// several megabytes large
+const maxIndexSize = 64 << 20
+
+// index is the index.yaml of a chart repository. It's decoded with yaml.v3 rather than converted to JSON, so
+// unquoted versions like appVersion: 1.10 keep their text instead of becoming the 1.1 number.
+type index struct {
+	Entries map[string][]chartVersion `yaml:"entries"`
+}
+
+// indexVersions returns the versions of the chart listed in the repository index
+func (f *releaseFinder) indexVersions() ([]chartVersion, error) {
+	dat, err := f.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &index{}
+	if err := yaml.Unmarshal(dat, idx); err != nil {
+		return nil, fmt.Errorf("invalid repository index: %w", err)
+	}
+	charts, ok := idx.Entries[f.opts.chart]
+	if !ok {
+		return nil, fmt.Errorf("chart '%s' not found in the repository index", f.opts.chart)
+	}
+
+	var res []chartVersion
+	for _, c := range charts {
+		if f.opts.versions.Matches(c.Version) {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// readIndex reads the repository index from an HTTP(S) repository or a local file
+func (f *releaseFinder) readIndex() ([]byte, error) {
+	u, err := url.Parse(f.opts.repository)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if !isIndex(u.Path) {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/index.yaml"
+		}
+		return f.download(u.String())
+	}
+
+	file := f.opts.repository
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		file = filepath.Join(file, "index.yaml")
+	}
+	return ioutil.ReadFile(file)
+}
+
+// isIndex returns true if the path is the one of an index file rather than of the repository
+func isIndex(p string) bool {
+	ext := path.Ext(p)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// download fetches the repository index with the repository credentials
+func (f *releaseFinder) download(u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(f.opts.ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case f.opts.token != "":
+		req.Header.Set("Authorization", "Bearer "+f.opts.token)
+	case f.opts.username != "" || f.opts.password != "":
+		req.SetBasicAuth(f.opts.username, f.opts.password)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	dat, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxIndexSize {
+		return nil, fmt.Errorf("repository index larger than %d bytes", maxIndexSize)
+	}
+	return dat, nil
+}
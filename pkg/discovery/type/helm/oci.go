@@ -0,0 +1,90 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+)
+
+const (
+	// ConfigMediaType is the media type of the config of the charts pushed to OCI registries
+	ConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	// ContentMediaType is the media type of the chart archive layer of the charts pushed to OCI registries
+	ContentMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// ociVersions returns the versions of a chart pushed to an OCI registry: the tags of the chart repository
+// satisfying the version constraint, with the app version read from the chart config
+func (f *releaseFinder) ociVersions() ([]chartVersion, error) {
+	repository := strings.TrimSuffix(strings.TrimPrefix(f.opts.repository, ociScheme), "/") + "/" + f.opts.chart
+	ref, err := oci.ParseReference(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := f.charts.Tags(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []chartVersion
+	for _, tag := range tags {
+		// OCI tags can't hold the + of semver build metadata, Helm pushes it as _
+		version := strings.ReplaceAll(tag, "_", "+")
+		if !f.opts.versions.Matches(version) {
+			continue
+		}
+
+		c, err := f.ociChart(ref, tag)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// ociChart reads the chart metadata from the config of the manifest a tag points to
+func (f *releaseFinder) ociChart(ref oci.Reference, tag string) (chartVersion, error) {
+	m, err := f.charts.Manifest(ref, tag)
+	if err != nil {
+		return chartVersion{}, err
+	}
+	if m.Config.MediaType != ConfigMediaType {
+		return chartVersion{}, fmt.Errorf("%s:%s is not a Helm chart, config media type is '%s'", ref, tag, m.Config.MediaType)
+	}
+
+	dat, err := f.charts.Blob(ref, m.Config.Digest)
+	if err != nil {
+		return chartVersion{}, err
+	}
+	c := chartVersion{}
+	if err := json.Unmarshal(dat, &c); err != nil {
+		return chartVersion{}, fmt.Errorf("invalid chart config of %s:%s: %w", ref, tag, err)
+	}
+	// Report the digest of the chart archive, as the repository indexes do
+	for _, l := range m.Layers {
+		if l.MediaType == ContentMediaType {
+			c.Digest = strings.TrimPrefix(l.Digest, "sha256:")
+		}
+	}
+	return c, nil
+}
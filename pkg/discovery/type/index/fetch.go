@@ -0,0 +1,183 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxSize is the maximum size of the fetched files
+const maxSize = 32 << 20
+
+// cachedIndex is an index stored in the cache directory along with its validators
+type cachedIndex struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// get sends an authenticated GET request, setting the conditional headers of the cached index if any
+func (f *indexFinder) get(url string, cached *cachedIndex) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(f.opts.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case f.opts.token != "":
+		req.Header.Set("Authorization", "Bearer "+f.opts.token)
+	case f.opts.username != "" || f.opts.password != "":
+		req.SetBasicAuth(f.opts.username, f.opts.password)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	return f.client.Do(req)
+}
+
+// fetch returns the content of a URL
+func (f *indexFinder) fetch(url string) ([]byte, error) {
+	resp, err := f.get(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return readBody(resp.Body)
+}
+
+// fetchIndex returns the content and content type of the index. With a cache directory, unchanged indexes
+// are served from the cache.
+func (f *indexFinder) fetchIndex() ([]byte, string, error) {
+	cached := f.cached()
+	resp, err := f.get(f.opts.url, cached)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		logrus.Debugf("Index '%s' not modified, using the cached one", f.opts.url)
+		return cached.Body, cached.ContentType, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", fmt.Errorf("GET %s: %s", f.opts.url, resp.Status)
+	}
+
+	dat, err := readBody(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	f.store(&cachedIndex{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  contentType,
+		Body:         dat,
+	})
+	return dat, contentType, nil
+}
+
+// readBody reads a response body up to the maximum size
+func readBody(r io.Reader) ([]byte, error) {
+	dat, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxSize {
+		return nil, fmt.Errorf("response larger than %d bytes", maxSize)
+	}
+	return dat, nil
+}
+
+// cachePath returns the path of the cached index, keyed by its URL
+func (f *indexFinder) cachePath() string {
+	sum := sha256.Sum256([]byte(f.opts.url))
+	return filepath.Join(f.opts.cacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// cached returns the cached index, nil if there is none
+func (f *indexFinder) cached() *cachedIndex {
+	if f.opts.cacheDir == "" {
+		return nil
+	}
+	dat, err := ioutil.ReadFile(f.cachePath())
+	if err != nil {
+		return nil
+	}
+	c := &cachedIndex{}
+	if err := json.Unmarshal(dat, c); err != nil {
+		logrus.Warnf("Ignoring corrupted cached index: %s", err)
+		return nil
+	}
+	return c
+}
+
+// store writes the index to the cache directory if it has validators. Failures are only logged,
+// as the cache is an optimization.
+func (f *indexFinder) store(c *cachedIndex) {
+	if f.opts.cacheDir == "" || (c.ETag == "" && c.LastModified == "") {
+		return
+	}
+	if err := f.write(c); err != nil {
+		logrus.Warnf("Failed caching index '%s': %s", f.opts.url, err)
+	}
+}
+
+// write atomically replaces the cached index
+func (f *indexFinder) write(c *cachedIndex) error {
+	dat, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.opts.cacheDir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.opts.cacheDir, ".index-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(dat); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.cachePath())
+}
@@ -0,0 +1,264 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/manifest"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/internal/httputil"
+	"github.com/sirupsen/logrus"
+)
+
+type indexOptions struct {
+	url           string
+	username      string
+	password      string
+	token         string
+	caBundleFile  string
+	cacheDir      string
+	checksum      string
+	checksumURL   string
+	signatureURL  string
+	publicKeyFile string
+	strict        bool
+	ctx           context.Context
+}
+
+type indexSetting func(i *indexOptions) error
+
+// WithURL sets the HTTP(S) URL of the index listing the versions
+func WithURL(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		if s == "" {
+			return nil
+		}
+		if err := validateURL(s); err != nil {
+			return err
+		}
+		i.url = s
+		return nil
+	}
+}
+
+// WithContext sets a context for the discovery action
+func WithContext(ctx context.Context) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.ctx = ctx
+		return nil
+	}
+}
+
+// WithBasicAuth sets the credentials used to authenticate against the web server
+func WithBasicAuth(username, password string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.username = username
+		i.password = password
+		return nil
+	}
+}
+
+// WithToken sets a bearer token used to authenticate against the web server
+func WithToken(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.token = s
+		return nil
+	}
+}
+
+// WithCABundleFile trusts the PEM certificates of the file, on top of the system ones
+func WithCABundleFile(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.caBundleFile = s
+		return nil
+	}
+}
+
+// WithCacheDir stores the index in a directory, to send conditional requests with its ETag
+func WithCacheDir(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.cacheDir = s
+		return nil
+	}
+}
+
+// WithChecksum verifies the index against a SHA-256 or SHA-512 hex digest, optionally prefixed by the
+// algorithm, e.g. sha256:2c26b46b...
+func WithChecksum(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		if s == "" {
+			return nil
+		}
+		if _, _, err := parseChecksum(s); err != nil {
+			return err
+		}
+		i.checksum = s
+		return nil
+	}
+}
+
+// WithChecksumURL verifies the index against the digest published at the URL, in the sha256sum output format
+func WithChecksumURL(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		if s == "" {
+			return nil
+		}
+		if err := validateURL(s); err != nil {
+			return err
+		}
+		i.checksumURL = s
+		return nil
+	}
+}
+
+// WithSignatureURL sets the URL of the detached signature of the index, by default the index URL with a .sig extension
+func WithSignatureURL(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		if s == "" {
+			return nil
+		}
+		if err := validateURL(s); err != nil {
+			return err
+		}
+		i.signatureURL = s
+		return nil
+	}
+}
+
+// WithPublicKeyFile verifies the detached signature of the index with the PEM public key of the file,
+// an ECDSA, RSA or Ed25519 one
+func WithPublicKeyFile(s string) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.publicKeyFile = s
+		return nil
+	}
+}
+
+// WithStrict fails the discovery if any version of the index is invalid, instead of skipping it with a warning
+func WithStrict(value bool) indexSetting { //nolint:golint,revive
+	return func(i *indexOptions) error {
+		i.strict = value
+		return nil
+	}
+}
+
+func (i *indexOptions) apply(opts ...indexSetting) error {
+	for _, o := range opts {
+		if err := o(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateURL checks the URL is an absolute HTTP(S) one
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL '%s', must be an http or https one", s)
+	}
+	return nil
+}
+
+type indexFinder struct {
+	client *http.Client
+	opts   indexOptions
+}
+
+// NewIndexFinder returns a new discovery of the versions listed in an index served over HTTP(S)
+func NewIndexFinder(opts ...indexSetting) (*indexFinder, error) { //nolint:golint,revive
+	o := &indexOptions{
+		ctx: context.Background(),
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := httputil.NewTransport(o.caBundleFile, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &indexFinder{
+		client: &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		opts:   *o,
+	}, nil
+}
+
+// String identifies the finder in the discovery errors
+func (f *indexFinder) String() string {
+	return "http:" + f.opts.url
+}
+
+// Discovery retrieves the ManagedOSVersion listed in the index, once verified.
+// Invalid versions fail the discovery in strict mode, and are skipped with a warning otherwise.
+func (f *indexFinder) Discovery() ([]*provv1.ManagedOSVersion, error) {
+	if f.opts.url == "" {
+		return nil, errors.New("no index URL set")
+	}
+
+	dat, contentType, err := f.fetchIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.verify(dat); err != nil {
+		return nil, fmt.Errorf("verifying index '%s': %w", f.opts.url, err)
+	}
+
+	name := path.Base(urlPath(f.opts.url))
+	var res []*provv1.ManagedOSVersion
+	if strings.Contains(contentType, "json") || strings.EqualFold(path.Ext(name), ".json") {
+		res, err = manifest.ParseJSON(name, dat)
+	} else {
+		res, err = manifest.ParseYAML(name, dat)
+	}
+	if err == nil {
+		return res, nil
+	}
+	if f.opts.strict {
+		return nil, err
+	}
+
+	var errs *multierror.Error
+	if errors.As(err, &errs) {
+		for _, e := range errs.Errors {
+			logrus.Warnf("Skipping invalid version: %s", e)
+		}
+		return res, nil
+	}
+	return nil, err
+}
+
+// urlPath returns the path of a URL, or the URL itself if it can't be parsed
+func urlPath(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Path
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/index"
+)
+
+const jsonIndex = `[
+  {"metadata": {"name": "v0.1.0"}, "spec": {"version": "v0.1.0", "type": "container", "metadata": {"upgradeImage": "registry.local/os2:v0.1.0"}}},
+  {"metadata": {"name": "v0.2.0"}, "spec": {"version": "v0.2.0", "type": "container", "metadata": {"upgradeImage": "registry.local/os2:v0.2.0"}}}
+]`
+
+const yamlIndex = `apiVersion: v1
+kind: List
+items:
+- metadata:
+    name: v0.1.0
+  spec:
+    version: v0.1.0
+    type: iso
+---
+metadata:
+  name: v0.2.0
+spec:
+  type: iso
+`
+
+var _ = Describe("index discovery", func() {
+	var srv *httptest.Server
+	var files map[string]string
+	var requests, notModified int
+	var dir string
+
+	BeforeEach(func() {
+		files = map[string]string{
+			"/index.json": jsonIndex,
+			"/index.yaml": yamlIndex,
+		}
+		requests, notModified = 0, 0
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests++
+			if user, pass, ok := req.BasicAuth(); req.Header.Get("Authorization") != "Bearer secret" && (!ok || user != "foo" || pass != "bar") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			content, ok := files[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sum := sha256.Sum256([]byte(content))
+			etag := fmt.Sprintf(`"%x"`, sum[:8])
+			if req.Header.Get("If-None-Match") == etag {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write([]byte(content))
+		}))
+
+		var err error
+		dir, err = os.MkdirTemp("", "index")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("fails if there aren't enough information", func() {
+		rf, err := NewIndexFinder()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewIndexFinder(WithURL("ftp://example.com/index.json"))
+		Expect(err).To(HaveOccurred())
+		_, err = NewIndexFinder(WithChecksum("sha512:abcd"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists the versions of JSON and YAML indexes", func() {
+		rf, err := NewIndexFinder(WithURL(srv.URL+"/index.json"), WithBasicAuth("foo", "bar"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0", "v0.2.0"}))
+		Expect(res[1].Spec.Metadata.Data["upgradeImage"]).To(Equal("registry.local/os2:v0.2.0"))
+
+		rf, err = NewIndexFinder(WithURL(srv.URL+"/index.yaml"), WithToken("secret"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err = rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(Equal([]string{"v0.1.0"}))
+
+		rf, err = NewIndexFinder(WithURL(srv.URL+"/index.yaml"), WithToken("secret"), WithStrict(true))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("index.yaml: document 2: missing required fields: spec.version")))
+
+		rf, err = NewIndexFinder(WithURL(srv.URL + "/index.json"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("401")))
+	})
+
+	It("trusts a custom CA bundle", func() {
+		tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(jsonIndex))
+		}))
+		defer tlsSrv.Close()
+
+		rf, err := NewIndexFinder(WithURL(tlsSrv.URL + "/index.json"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		bundle := filepath.Join(dir, "ca.pem")
+		Expect(ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw}), 0600)).To(Succeed())
+		rf, err = NewIndexFinder(WithURL(tlsSrv.URL+"/index.json"), WithCABundleFile(bundle))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+	})
+
+	It("caches the index with its ETag", func() {
+		cache := filepath.Join(dir, "cache")
+		for i := 0; i < 2; i++ {
+			rf, err := NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithCacheDir(cache))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(HaveLen(2))
+		}
+		Expect(requests).To(Equal(2))
+		Expect(notModified).To(Equal(1))
+	})
+
+	It("verifies checksums", func() {
+		sum := sha256.Sum256([]byte(jsonIndex))
+		digest := hex.EncodeToString(sum[:])
+		files["/SHA256SUMS"] = fmt.Sprintf("%x  index.yaml\n%s  index.json\n", sha256.Sum256([]byte(yamlIndex)), digest)
+
+		res, err := discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithChecksum(digest)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+
+		res, err = discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithChecksum("sha256:"+digest)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+
+		res, err = discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithChecksumURL(srv.URL+"/SHA256SUMS")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+
+		_, err = discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.yaml"), WithToken("secret"), WithChecksum(digest)))
+		Expect(err).To(MatchError(ContainSubstring("sha256 checksum mismatch")))
+	})
+
+	It("verifies signatures", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).ToNot(HaveOccurred())
+		keyFile := filepath.Join(dir, "key.pub")
+		Expect(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0600)).To(Succeed())
+
+		digest := sha256.Sum256([]byte(jsonIndex))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		Expect(err).ToNot(HaveOccurred())
+		files["/index.json.sig"] = base64.StdEncoding.EncodeToString(sig)
+		files["/index.yaml.sig"] = string(sig)
+
+		res, err := discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithPublicKeyFile(keyFile)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(HaveLen(2))
+
+		_, err = discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.yaml"), WithToken("secret"), WithPublicKeyFile(keyFile)))
+		Expect(err).To(MatchError(ContainSubstring("invalid signature")))
+
+		_, err = discoverytest.Discover(NewIndexFinder(WithURL(srv.URL+"/index.json"), WithToken("secret"), WithPublicKeyFile(keyFile), WithSignatureURL(srv.URL+"/missing.sig")))
+		Expect(err).To(MatchError(ContainSubstring("fetching signature")))
+	})
+})
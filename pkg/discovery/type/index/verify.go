@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// verify checks the index against its checksum and its detached signature, when set
+func (f *indexFinder) verify(dat []byte) error {
+	if err := f.verifyChecksum(dat); err != nil {
+		return err
+	}
+	if f.opts.publicKeyFile == "" {
+		return nil
+	}
+
+	sigURL := f.opts.signatureURL
+	if sigURL == "" {
+		sigURL = f.opts.url + ".sig"
+	}
+	sig, err := f.fetch(sigURL)
+	if err != nil {
+		return fmt.Errorf("fetching signature: %w", err)
+	}
+	return verifySignature(f.opts.publicKeyFile, dat, sig)
+}
+
+// verifyChecksum compares the digest of the index with the configured or published checksum
+func (f *indexFinder) verifyChecksum(dat []byte) error {
+	checksum := f.opts.checksum
+	if checksum == "" && f.opts.checksumURL != "" {
+		sums, err := f.fetch(f.opts.checksumURL)
+		if err != nil {
+			return fmt.Errorf("fetching checksum: %w", err)
+		}
+		if checksum, err = findChecksum(sums, path.Base(urlPath(f.opts.url))); err != nil {
+			return err
+		}
+	}
+	if checksum == "" {
+		return nil
+	}
+
+	algorithm, expected, err := parseChecksum(checksum)
+	if err != nil {
+		return err
+	}
+	var actual []byte
+	switch algorithm {
+	case "sha512":
+		sum := sha512.Sum512(dat)
+		actual = sum[:]
+	default:
+		sum := sha256.Sum256(dat)
+		actual = sum[:]
+	}
+	if subtle.ConstantTimeCompare(actual, expected) != 1 {
+		return fmt.Errorf("%s checksum mismatch: expected %x, got %x", algorithm, expected, actual)
+	}
+	return nil
+}
+
+// findChecksum returns the checksum of a file from the output of sha256sum or sha512sum. A single checksum
+// without file name, or the only one of the output, is used regardless of the file name.
+func findChecksum(sums []byte, name string) (string, error) {
+	var lines [][]string
+	for _, l := range strings.Split(string(sums), "\n") {
+		if fields := strings.Fields(l); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+	if len(lines) == 1 {
+		return lines[0][0], nil
+	}
+	for _, fields := range lines {
+		if len(fields) > 1 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum found for '%s'", name)
+}
+
+// parseChecksum returns the algorithm and the digest of a hex checksum, optionally prefixed by its algorithm
+func parseChecksum(s string) (string, []byte, error) {
+	algorithm := ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		algorithm, s = s[:i], s[i+1:]
+	}
+	digest, err := hex.DecodeString(s)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid checksum '%s': %w", s, err)
+	}
+
+	var expected string
+	switch len(digest) {
+	case sha256.Size:
+		expected = "sha256"
+	case sha512.Size:
+		expected = "sha512"
+	default:
+		return "", nil, fmt.Errorf("invalid checksum '%s': not a sha256 or sha512 digest", s)
+	}
+	if algorithm != "" && algorithm != expected {
+		return "", nil, fmt.Errorf("invalid checksum '%s': not a %s digest", s, algorithm)
+	}
+	return expected, digest, nil
+}
+
+// verifySignature checks the signature of the index with the public key of the file. The signature is
+// either raw or base64 encoded, as produced by openssl dgst -sha256 -sign or cosign sign-blob.
+// ECDSA and RSA signatures are made on the SHA-256 digest of the index, Ed25519 ones on the index itself.
+func verifySignature(keyFile string, dat, sig []byte) error {
+	key, err := readPublicKey(keyFile)
+	if err != nil {
+		return err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = decoded
+	}
+
+	digest := sha256.Sum256(dat)
+	valid := false
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, digest[:], sig)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, dat, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// readPublicKey reads a PEM encoded PKIX public key
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key found in '%s'", file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key '%s': %w", file, err)
+	}
+	return key, nil
+}
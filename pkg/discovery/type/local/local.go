@@ -0,0 +1,210 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/sirupsen/logrus"
+)
+
+type localOptions struct {
+	path    string
+	subdir  string
+	strict  bool
+	include []string
+	exclude []string
+}
+
+type localSetting func(l *localOptions) error
+
+// WithPath sets the directory to retrieve versions from, or a single version file
+func WithPath(s string) localSetting { //nolint:golint,revive
+	return func(l *localOptions) error {
+		l.path = s
+		return nil
+	}
+}
+
+// WithSubpath restricts the discovery to a subpath of the directory, errors still refer to paths relative to the directory
+func WithSubpath(s string) localSetting { //nolint:golint,revive
+	return func(l *localOptions) error {
+		l.subdir = s
+		return nil
+	}
+}
+
+// WithStrict fails the discovery if any version file is invalid, instead of skipping it with a warning
+func WithStrict(value bool) localSetting { //nolint:golint,revive
+	return func(l *localOptions) error {
+		l.strict = value
+		return nil
+	}
+}
+
+// WithInclude sets the glob patterns of the version files to parse, by default *.json, *.yaml and *.yml.
+// Patterns without a slash match the file name, others the path relative to the subpath.
+func WithInclude(patterns ...string) localSetting { //nolint:golint,revive
+	return func(l *localOptions) error {
+		if len(patterns) == 0 {
+			return nil
+		}
+		if err := ValidatePatterns(patterns); err != nil {
+			return err
+		}
+		l.include = patterns
+		return nil
+	}
+}
+
+// WithExclude sets the glob patterns of the files to ignore, matched like the WithInclude ones
+func WithExclude(patterns ...string) localSetting { //nolint:golint,revive
+	return func(l *localOptions) error {
+		if err := ValidatePatterns(patterns); err != nil {
+			return err
+		}
+		l.exclude = patterns
+		return nil
+	}
+}
+
+// ValidatePatterns checks the syntax of file glob patterns
+func ValidatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid file pattern '%s': %w", p, err)
+		}
+	}
+	return nil
+}
+
+func (l *localOptions) apply(opts ...localSetting) error {
+	for _, o := range opts {
+		if err := o(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewReleaseFinder returns a new discovery of the version files of a local directory
+func NewReleaseFinder(opts ...localSetting) (*releaseFinder, error) { //nolint:golint,revive
+	o := &localOptions{
+		include: []string{"*.json", "*.yaml", "*.yml"},
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &releaseFinder{
+		opts: *o,
+	}, nil
+}
+
+type releaseFinder struct {
+	opts localOptions
+}
+
+// String identifies the finder in the discovery errors
+func (f *releaseFinder) String() string {
+	return "local:" + f.opts.path
+}
+
+// Discovery retrieves the ManagedOSVersion of the version files found in the directory.
+// Invalid files fail the discovery in strict mode, and are skipped with a warning otherwise. Errors walking
+// the directory, like a missing path or subpath, always fail the discovery so they can't empty the channel.
+func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	if f.opts.path == "" {
+		return nil, errors.New("no path set")
+	}
+
+	var errs *multierror.Error
+	root := filepath.Join(f.opts.path, f.opts.subdir)
+	err = filepath.Walk(root,
+		func(path string, info os.FileInfo, err error) error {
+
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// hidden directories hold the files of other tools, like .git or .github
+				if path != root && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// A file given as root is parsed whatever its name
+			if path != root && !f.matches(root, path) {
+				return nil
+			}
+
+			logrus.Infof("'%s' found", path)
+
+			v, err := parseFile(f.opts.path, path)
+			res = append(res, v...)
+			if err != nil {
+				errs = multierror.Append(errs, err)
+			}
+			return nil
+
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if errs.ErrorOrNil() == nil {
+		return res, nil
+	}
+	if f.opts.strict {
+		return nil, errs
+	}
+	for _, e := range errs.Errors {
+		logrus.Warnf("Skipping invalid version: %s", e)
+	}
+	return res, nil
+}
+
+// matches returns true if the file is included and not excluded by the file patterns
+func (f *releaseFinder) matches(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return matchAny(f.opts.include, rel) && !matchAny(f.opts.exclude, rel)
+}
+
+func matchAny(patterns []string, path string) bool {
+	path = filepath.ToSlash(path)
+	for _, p := range patterns {
+		name := path
+		if !strings.Contains(p, "/") {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/local"
+)
+
+// newDir creates a directory with the given files, and returns its path
+func newDir(files map[string]string) string {
+	dir, err := os.MkdirTemp("", "local")
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		ExpectWithOffset(1, os.MkdirAll(filepath.Dir(path), os.ModePerm)).To(Succeed())
+		ExpectWithOffset(1, ioutil.WriteFile(path, []byte(content), os.ModePerm)).To(Succeed())
+	}
+	return dir
+}
+
+func version(name string) string {
+	return `{"metadata": {"name": "` + name + `"}, "spec": {"version": "` + name + `", "type": "container", "metadata": {"upgradeImage": "foo/bar:` + name + `"}}}`
+}
+
+var _ = Describe("local discovery", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = newDir(map[string]string{
+			"v0.1.0.json":        version("v0.1.0"),
+			"v0.2.0.yaml":        "metadata:\n  name: v0.2.0\nspec:\n  version: v0.2.0\n  type: container\n",
+			"sub/stream.yml":     "---\n" + version("v0.3.0") + "\n---\n" + version("v0.3.1") + "\n",
+			"sub/truncated.json": "{\"metadata\": ",
+			"drafts/v1.0.json":   version("v1.0.0"),
+			".git/v9.9.json":     version("v9.9.9"),
+			"versions.txt":       version("v0.4.0"),
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("fails if there aren't enough information", func() {
+		rf, err := NewReleaseFinder()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewReleaseFinder(WithPath(dir), WithExclude("[a-"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("parses the version files of the directory", func() {
+		rf, err := NewReleaseFinder(WithPath(dir))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0", "v0.2.0", "v0.3.0", "v0.3.1", "v1.0.0"))
+
+		rf, err = NewReleaseFinder(WithPath(dir), WithStrict(true))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("sub/truncated.json:1:14")))
+	})
+
+	It("filters files with subpaths, include and exclude patterns", func() {
+		rf, err := NewReleaseFinder(WithPath(dir), WithSubpath("sub"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(ConsistOf("v0.3.0", "v0.3.1"))
+
+		rf, err = NewReleaseFinder(WithPath(dir), WithStrict(true), WithInclude("*.json", "*.txt"), WithExclude("drafts/*", "sub/*"))
+		Expect(err).ToNot(HaveOccurred())
+		res, err = rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(ConsistOf("v0.1.0", "v0.4.0"))
+	})
+
+	It("parses a single file whatever its name", func() {
+		rf, err := NewReleaseFinder(WithPath(filepath.Join(dir, "versions.txt")))
+		Expect(err).ToNot(HaveOccurred())
+		res, err := rf.Discovery()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(discoverytest.Names(res)).To(ConsistOf("v0.4.0"))
+
+		rf, err = NewReleaseFinder(WithPath(filepath.Join(dir, "sub", "truncated.json")), WithStrict(true))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(MatchError(ContainSubstring("truncated.json:1:14")))
+	})
+
+	It("fails on missing paths", func() {
+		rf, err := NewReleaseFinder(WithPath(filepath.Join(dir, "missing")))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+
+		rf, err = NewReleaseFinder(WithPath(dir), WithSubpath("missing"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails on missing paths in strict mode", func() {
+		rf, err := NewReleaseFinder(WithPath(filepath.Join(dir, "missing")), WithStrict(true))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rf.Discovery()
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,42 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/manifest"
+)
+
+// parseFile reads and validates the ManagedOSVersion of a file, errors refer to its path relative to the
+// directory, or to its name when it's the directory itself.
+// The valid versions are returned along with the errors of the invalid ones.
+func parseFile(dir, path string) ([]*provv1.ManagedOSVersion, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if rel, err := filepath.Rel(dir, path); err == nil && rel != "." {
+		path = rel
+	} else {
+		path = filepath.Base(path)
+	}
+	return manifest.Parse(path, dat)
+}
@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+
+	provv1 "github.com/rancher-sandbox/rancheros-operator/pkg/apis/rancheros.cattle.io/v1"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/release"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+	"github.com/sirupsen/logrus"
+)
+
+type registryOptions struct {
+	repository        string
+	username          string
+	password          string
+	token             string
+	plainHTTP         bool
+	versionNamePrefix string
+	versionNameSuffix string
+	tags              release.TagFilter
+	digestPinning     bool
+	missingImages     release.MissingImagePolicy
+	ctx               context.Context
+}
+
+type registrySetting func(r *registryOptions) error
+
+// WithRepository sets the image repository to list tags from, e.g. quay.io/costoolkit/os2
+func WithRepository(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.repository = s
+		return nil
+	}
+}
+
+// WithContext sets a context for the discovery action
+func WithContext(ctx context.Context) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.ctx = ctx
+		return nil
+	}
+}
+
+// WithBasicAuth sets the credentials used to authenticate against the registry
+func WithBasicAuth(username, password string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.username = username
+		r.password = password
+		return nil
+	}
+}
+
+// WithToken sets a bearer token used to authenticate against the registry
+func WithToken(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.token = s
+		return nil
+	}
+}
+
+// WithPlainHTTP talks to the registry over plain HTTP instead of HTTPS
+func WithPlainHTTP(value bool) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.plainHTTP = value
+		return nil
+	}
+}
+
+// WithVersionNamePrefix adds a prefix to the created ManagedOSVersion resource
+func WithVersionNamePrefix(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.versionNamePrefix = s
+		return nil
+	}
+}
+
+// WithVersionNameSuffix appends a suffix to the created ManagedOSVersion resource
+func WithVersionNameSuffix(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.versionNameSuffix = s
+		return nil
+	}
+}
+
+// WithTagPattern only includes the tags matching the given regular expression
+func WithTagPattern(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		return r.tags.SetPattern(s)
+	}
+}
+
+// WithTagConstraint only includes the semver tags satisfying the given constraint
+func WithTagConstraint(s string) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		return r.tags.SetConstraint(s)
+	}
+}
+
+// WithDigestPinning pins the upgrade images to the digest their tag points to
+func WithDigestPinning(value bool) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		r.digestPinning = value
+		return nil
+	}
+}
+
+// WithMissingImagePolicy sets how tags whose manifest doesn't exist anymore are handled when pinning digests
+func WithMissingImagePolicy(p release.MissingImagePolicy) registrySetting { //nolint:golint,revive
+	return func(r *registryOptions) error {
+		if p == "" {
+			return nil
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		r.missingImages = p
+		return nil
+	}
+}
+
+func (r *registryOptions) apply(opts ...registrySetting) error {
+	for _, o := range opts {
+		if err := o(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewReleaseFinder returns a new container registry release finder discovery with the required settings
+func NewReleaseFinder(opts ...registrySetting) (*releaseFinder, error) { //nolint:golint,revive
+	o := &registryOptions{
+		ctx:           context.Background(),
+		missingImages: release.MissingImageDrop,
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := oci.NewClient(
+		oci.WithContext(o.ctx),
+		oci.WithBasicAuth(o.username, o.password),
+		oci.WithToken(o.token),
+		oci.WithPlainHTTP(o.plainHTTP),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &releaseFinder{
+		api:  cli,
+		opts: *o,
+	}, nil
+}
+
+type releaseFinder struct {
+	api  *oci.Client
+	opts registryOptions
+}
+
+// String identifies the finder in the discovery errors
+func (f *releaseFinder) String() string {
+	return "registry:" + f.opts.repository
+}
+
+// Discovery retrieves ManagedOSVersion from the tags of a container registry repository
+func (f *releaseFinder) Discovery() (res []*provv1.ManagedOSVersion, err error) {
+	ref, err := oci.ParseReference(f.opts.repository)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Listing tags of %s", ref)
+	tags, err := f.api.Tags(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	naming := release.Naming{
+		NamePrefix: f.opts.versionNamePrefix,
+		NameSuffix: f.opts.versionNameSuffix,
+		BaseImage:  f.opts.repository,
+		Repository: f.opts.repository,
+	}
+
+	for _, t := range tags {
+		if !f.opts.tags.Matches(t) {
+			continue
+		}
+		v, err := naming.ContainerVersion(t, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+
+	if !f.opts.digestPinning {
+		return
+	}
+	return release.PinDigests(f.api, res, f.opts.missingImages)
+}
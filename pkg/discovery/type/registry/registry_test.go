@@ -0,0 +1,159 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/discoverytest"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/discovery/type/registry"
+	"github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci/ocitest"
+)
+
+var _ = Describe("registry discovery", func() {
+	var reg *ocitest.Registry
+	var repo string
+
+	BeforeEach(func() {
+		reg = ocitest.NewRegistry()
+		repo = reg.Host() + "/costoolkit/os2"
+		for _, t := range []string{"v0.1.0", "v0.2.0", "v0.3.0-rc1", "latest"} {
+			reg.Push("costoolkit/os2", t)
+		}
+	})
+
+	AfterEach(func() {
+		reg.Close()
+	})
+
+	Context("discovery", func() {
+		It("fails if there aren't enough information", func() {
+			rf, err := NewReleaseFinder()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails with invalid filters", func() {
+			_, err := NewReleaseFinder(WithTagPattern("("))
+			Expect(err).To(HaveOccurred())
+
+			_, err = NewReleaseFinder(WithTagConstraint("foo"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails on unknown repositories", func() {
+			rf, err := NewReleaseFinder(WithRepository(reg.Host()+"/foo/bar"), WithPlainHTTP(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("detects all the tags", func() {
+			reg.PageSize = 1
+			rf, err := NewReleaseFinder(
+				WithRepository(repo),
+				WithPlainHTTP(true),
+				WithVersionNamePrefix("os2-"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("os2-v0.1.0", "os2-v0.2.0", "os2-v0.3.0-rc1", "os2-latest"))
+
+			for _, r := range res {
+				Expect(r.Spec.Type).To(Equal("container"))
+				Expect(r.Spec.Metadata.Data["upgradeImage"]).To(Equal(repo + ":" + r.Spec.Version))
+			}
+		})
+
+		It("filters tags", func() {
+			rf, err := NewReleaseFinder(
+				WithRepository(repo),
+				WithPlainHTTP(true),
+				WithTagPattern("^v"),
+				WithTagConstraint(">=v0.2.0-0"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(discoverytest.Names(res)).To(ConsistOf("v0.2.0", "v0.3.0-rc1"))
+		})
+
+		It("pins digests", func() {
+			digest := reg.Push("costoolkit/os2", "v0.4.0")
+
+			rf, err := NewReleaseFinder(
+				WithRepository(repo),
+				WithPlainHTTP(true),
+				WithTagPattern("^v0.4"),
+				WithDigestPinning(true),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(1))
+			Expect(res[0].Spec.Metadata.Data["upgradeImage"]).To(Equal(repo + "@" + digest))
+			Expect(res[0].Spec.Metadata.Data["upgradeImageTag"]).To(Equal(repo + ":v0.4.0"))
+		})
+
+		It("authenticates with basic auth", func() {
+			reg.Username, reg.Password = "foo", "bar"
+
+			rf, err := NewReleaseFinder(WithRepository(repo), WithPlainHTTP(true))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+
+			rf, err = NewReleaseFinder(WithRepository(repo), WithPlainHTTP(true), WithBasicAuth("foo", "bar"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(4))
+		})
+
+		It("authenticates against a token service", func() {
+			reg.Username, reg.Password, reg.TokenAuth = "foo", "bar", true
+
+			rf, err := NewReleaseFinder(WithRepository(repo), WithPlainHTTP(true), WithBasicAuth("foo", "baz"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rf.Discovery()
+			Expect(err).To(HaveOccurred())
+
+			rf, err = NewReleaseFinder(WithRepository(repo), WithPlainHTTP(true), WithBasicAuth("foo", "bar"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(4))
+		})
+
+		It("authenticates with a bearer token", func() {
+			reg.Username, reg.TokenAuth = "foo", true
+
+			rf, err := NewReleaseFinder(WithRepository(repo), WithPlainHTTP(true), WithToken("ocitest-token"))
+			Expect(err).ToNot(HaveOccurred())
+			res, err := rf.Discovery()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(res)).To(Equal(4))
+		})
+	})
+})
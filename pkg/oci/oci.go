@@ -0,0 +1,484 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dockerHubRegistry  = "registry-1.docker.io"
+	dockerHubNamespace = "library"
+)
+
+// Reference is a parsed image repository reference, e.g. quay.io/costoolkit/os2
+type Reference struct {
+	Registry   string
+	Repository string
+}
+
+// String returns the reference in its canonical registry/repository form
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// ParseReference parses a repository reference, without tag nor digest.
+// References without a registry host default to the Docker Hub.
+func ParseReference(s string) (Reference, error) {
+	if s == "" {
+		return Reference{}, fmt.Errorf("empty repository reference")
+	}
+	if strings.ContainsAny(s, "@") {
+		return Reference{}, fmt.Errorf("invalid repository reference '%s': digests are not allowed", s)
+	}
+
+	ref := Reference{Registry: dockerHubRegistry, Repository: s}
+	parts := strings.SplitN(s, "/", 2)
+	switch {
+	case len(parts) == 1:
+		ref.Repository = dockerHubNamespace + "/" + s
+	case strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost":
+		ref = Reference{Registry: parts[0], Repository: parts[1]}
+	}
+
+	if strings.Contains(ref.Repository, ":") {
+		return Reference{}, fmt.Errorf("invalid repository reference '%s': tags are not allowed", s)
+	}
+	return ref, nil
+}
+
+// ParseImage parses an image reference with a tag, e.g. quay.io/costoolkit/os2:v0.1.0
+func ParseImage(s string) (Reference, string, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 || strings.Contains(s[i:], "/") {
+		return Reference{}, "", fmt.Errorf("invalid image reference '%s': missing tag", s)
+	}
+
+	ref, err := ParseReference(s[:i])
+	if err != nil {
+		return Reference{}, "", err
+	}
+	return ref, s[i+1:], nil
+}
+
+// ErrNotFound is returned when a manifest doesn't exist in the registry
+var ErrNotFound = errors.New("manifest not found")
+
+type clientOptions struct {
+	username  string
+	password  string
+	token     string
+	plainHTTP bool
+	client    *http.Client
+	ctx       context.Context
+}
+
+type clientSetting func(c *clientOptions) error
+
+// WithBasicAuth sets the credentials used against the registry or its token service
+func WithBasicAuth(username, password string) clientSetting { //nolint:golint,revive
+	return func(c *clientOptions) error {
+		c.username = username
+		c.password = password
+		return nil
+	}
+}
+
+// WithToken sets a static bearer token sent to the registry
+func WithToken(s string) clientSetting { //nolint:golint,revive
+	return func(c *clientOptions) error {
+		c.token = s
+		return nil
+	}
+}
+
+// WithPlainHTTP talks to the registry over plain HTTP instead of HTTPS
+func WithPlainHTTP(value bool) clientSetting { //nolint:golint,revive
+	return func(c *clientOptions) error {
+		c.plainHTTP = value
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for the requests
+func WithHTTPClient(hc *http.Client) clientSetting { //nolint:golint,revive
+	return func(c *clientOptions) error {
+		c.client = hc
+		return nil
+	}
+}
+
+// WithContext sets a context for the registry requests
+func WithContext(ctx context.Context) clientSetting { //nolint:golint,revive
+	return func(c *clientOptions) error {
+		c.ctx = ctx
+		return nil
+	}
+}
+
+func (c *clientOptions) apply(opts ...clientSetting) error {
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewClient returns a new client for the OCI distribution API with the required settings
+func NewClient(opts ...clientSetting) (*Client, error) {
+	o := &clientOptions{
+		ctx: context.Background(),
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	err := o.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		opts:  *o,
+		auths: map[string]string{},
+	}, nil
+}
+
+// Client is a minimal client of the OCI distribution API
+type Client struct {
+	opts clientOptions
+
+	mu sync.Mutex
+	// auths caches the Authorization headers accepted by the registries, by repository
+	auths map[string]string
+}
+
+// tagList is the response of the tags list endpoint
+type tagList struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+var nextLinkRegexp = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// Tags returns all the tags of a repository, following the pagination links
+func (c *Client) Tags(ref Reference) ([]string, error) {
+	u := c.url(ref, "/tags/list")
+
+	var tags []string
+	for u != "" {
+		resp, err := c.do(http.MethodGet, u, ref, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		dat, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("listing tags of '%s' failed: %s", ref, resp.Status)
+		}
+
+		list := &tagList{}
+		if err := json.Unmarshal(dat, list); err != nil {
+			return nil, fmt.Errorf("invalid tags list of '%s': %w", ref, err)
+		}
+		tags = append(tags, list.Tags...)
+
+		u = ""
+		if m := nextLinkRegexp.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			next, err := resp.Request.URL.Parse(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pagination link '%s': %w", m[1], err)
+			}
+			u = next.String()
+		}
+	}
+
+	return tags, nil
+}
+
+// manifestMediaTypes are the manifest media types accepted when resolving digests
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Digest returns the digest of the manifest a tag points to, or ErrNotFound if it doesn't exist
+func (c *Client) Digest(ref Reference, tag string) (string, error) {
+	header := http.Header{"Accept": manifestMediaTypes}
+	u := c.url(ref, "/manifests/"+tag)
+
+	resp, err := c.do(http.MethodHead, u, ref, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s:%s: %w", ref, tag, ErrNotFound)
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("Docker-Content-Digest") != "":
+		return resp.Header.Get("Docker-Content-Digest"), nil
+	}
+
+	// Not all the registries return the digest on HEAD requests, compute it from the manifest
+	resp, err = c.do(http.MethodGet, u, ref, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%s:%s: %w", ref, tag, ErrNotFound)
+	default:
+		return "", fmt.Errorf("fetching manifest of '%s:%s' failed: %s", ref, tag, resp.Status)
+	}
+
+	dat, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(dat)), nil
+}
+
+// Descriptor references a content of the registry in a manifest
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest is an OCI image manifest, as used by images and artifacts like Helm charts
+type Manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+}
+
+// maxManifestSize is the maximum size of the manifests and blobs read in memory
+const maxManifestSize = 4 << 20
+
+// Manifest returns the image manifest a tag or digest points to, or ErrNotFound if it doesn't exist
+func (c *Client) Manifest(ref Reference, reference string) (*Manifest, error) {
+	header := http.Header{"Accept": []string{"application/vnd.oci.image.manifest.v1+json", "application/vnd.docker.distribution.manifest.v2+json"}}
+	resp, err := c.do(http.MethodGet, c.url(ref, "/manifests/"+reference), ref, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s:%s: %w", ref, reference, ErrNotFound)
+	default:
+		return nil, fmt.Errorf("fetching manifest of '%s:%s' failed: %s", ref, reference, resp.Status)
+	}
+
+	m := &Manifest{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(m); err != nil {
+		return nil, fmt.Errorf("invalid manifest of '%s:%s': %w", ref, reference, err)
+	}
+	return m, nil
+}
+
+// Blob returns the content of a blob, verified against its digest
+func (c *Client) Blob(ref Reference, digest string) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, c.url(ref, "/blobs/"+digest), ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching blob '%s' of '%s' failed: %s", digest, ref, resp.Status)
+	}
+
+	dat, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(dat) > maxManifestSize {
+		return nil, fmt.Errorf("blob '%s' of '%s' larger than %d bytes", digest, ref, maxManifestSize)
+	}
+	if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(dat)); actual != digest {
+		return nil, fmt.Errorf("blob '%s' of '%s' doesn't match its digest, got %s", digest, ref, actual)
+	}
+	return dat, nil
+}
+
+func (c *Client) url(ref Reference, path string) string {
+	scheme := "https"
+	if c.opts.plainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s%s", scheme, ref.Registry, ref.Repository, path)
+}
+
+// do sends a request to the registry, answering the authentication challenges if needed
+func (c *Client) do(method, u string, ref Reference, header http.Header) (*http.Response, error) {
+	send := func(auth string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(c.opts.ctx, method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return c.opts.client.Do(req)
+	}
+
+	auth := c.cachedAuth(ref)
+	resp, err := send(auth)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	auth, err = c.authorize(ref, resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.auths[ref.String()] = auth
+	c.mu.Unlock()
+
+	return send(auth)
+}
+
+func (c *Client) cachedAuth(ref Reference) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if auth, ok := c.auths[ref.String()]; ok {
+		return auth
+	}
+	if c.opts.token != "" {
+		return "Bearer " + c.opts.token
+	}
+	return ""
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorize answers a WWW-Authenticate challenge, returning the Authorization header to use
+func (c *Client) authorize(ref Reference, challenge string) (string, error) {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	switch scheme {
+	case "basic":
+		if c.opts.username == "" {
+			return "", fmt.Errorf("registry '%s' requires credentials", ref.Registry)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(c.opts.username, c.opts.password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge from '%s': '%s'", ref.Registry, challenge)
+	}
+
+	params := map[string]string{}
+	for _, m := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("missing realm in authentication challenge from '%s'", ref.Registry)
+	}
+
+	token, err := c.fetchToken(ref, params)
+	if err != nil {
+		return "", err
+	}
+	return "Bearer " + token, nil
+}
+
+// tokenResponse is the response of a registry token service
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func (c *Client) fetchToken(ref Reference, params map[string]string) (string, error) {
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm '%s': %w", params["realm"], err)
+	}
+
+	q := u.Query()
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(c.opts.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.opts.username != "" {
+		req.SetBasicAuth(c.opts.username, c.opts.password)
+	}
+
+	resp, err := c.opts.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to '%s' failed: %s", u.Host, resp.Status)
+	}
+
+	t := &tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(t); err != nil {
+		return "", fmt.Errorf("invalid token response from '%s': %w", u.Host, err)
+	}
+	if t.Token != "" {
+		return t.Token, nil
+	}
+	if t.AccessToken != "" {
+		return t.AccessToken, nil
+	}
+	return "", fmt.Errorf("empty token returned by '%s'", u.Host)
+}
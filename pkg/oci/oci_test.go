@@ -0,0 +1,49 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/rancher-sandbox/upgradechannel-discovery/pkg/oci"
+)
+
+var _ = Describe("oci", func() {
+	Context("references", func() {
+		It("parses repository references", func() {
+			for s, ref := range map[string]Reference{
+				"quay.io/costoolkit/os2":   {Registry: "quay.io", Repository: "costoolkit/os2"},
+				"localhost:5000/os2":       {Registry: "localhost:5000", Repository: "os2"},
+				"localhost/os2":            {Registry: "localhost", Repository: "os2"},
+				"rancher/os2":              {Registry: "registry-1.docker.io", Repository: "rancher/os2"},
+				"ubuntu":                   {Registry: "registry-1.docker.io", Repository: "library/ubuntu"},
+				"127.0.0.1:5000/foo/bar/z": {Registry: "127.0.0.1:5000", Repository: "foo/bar/z"},
+			} {
+				r, err := ParseReference(s)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(r).To(Equal(ref))
+			}
+		})
+
+		It("rejects tags and digests", func() {
+			for _, s := range []string{"", "ubuntu:20.04", "quay.io/costoolkit/os2:v0.1.0", "quay.io/costoolkit/os2@sha256:abc"} {
+				_, err := ParseReference(s)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+})
@@ -0,0 +1,231 @@
+/*
+Copyright © 2022 SUSE LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ocitest provides an in-process OCI registry for tests.
+package ocitest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ManifestMediaType is the media type of the manifests served by the registry
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+	token = "ocitest-token"
+)
+
+// Registry is an in-process registry implementing the subset of the OCI distribution API used by discovery
+type Registry struct {
+	*httptest.Server
+
+	// Username and Password, if set, are required to access the registry
+	Username string
+	Password string
+	// TokenAuth makes the registry issue bearer tokens from a token service instead of accepting basic auth
+	TokenAuth bool
+	// PageSize, if set, paginates the tags list
+	PageSize int
+
+	mu        sync.Mutex
+	manifests map[string]map[string][]byte
+	blobs     map[string][]byte
+}
+
+// NewRegistry starts and returns a new anonymous Registry. The caller should call Close when finished.
+func NewRegistry() *Registry {
+	r := &Registry{
+		manifests: map[string]map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// Host returns the host:port of the registry, to be used in image references
+func (r *Registry) Host() string {
+	u, _ := url.Parse(r.URL)
+	return u.Host
+}
+
+// Digest returns the digest of some content
+func Digest(dat []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(dat))
+}
+
+// Push adds a tag with a generated image manifest to a repository and returns the manifest digest
+func (r *Registry) Push(repository, tag string) string {
+	config := []byte(fmt.Sprintf(`{"repository":%q,"tag":%q}`, repository, tag))
+	return r.PushArtifact(repository, tag, "application/vnd.oci.image.config.v1+json", config)
+}
+
+// PushArtifact adds a tag with a manifest of the given config to a repository, as pushed for artifacts like
+// Helm charts, and returns the manifest digest. The config is served as a blob.
+func (r *Registry) PushArtifact(repository, tag, configMediaType string, config []byte) string {
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ManifestMediaType,
+		"config": map[string]interface{}{
+			"mediaType": configMediaType,
+			"digest":    Digest(config),
+			"size":      len(config),
+		},
+		"layers": []interface{}{},
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string][]byte{}
+	}
+	digest := Digest(manifest)
+	r.manifests[repository][tag] = manifest
+	r.manifests[repository][digest] = manifest
+	r.blobs[Digest(config)] = config
+	return digest
+}
+
+func (r *Registry) authorized(req *http.Request) bool {
+	if r.Username == "" {
+		return true
+	}
+
+	auth := req.Header.Get("Authorization")
+	if r.TokenAuth {
+		return auth == "Bearer "+token
+	}
+	u, p, ok := req.BasicAuth()
+	return ok && u == r.Username && p == r.Password
+}
+
+func (r *Registry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.serveToken(w, req)
+		return
+	}
+
+	if !r.authorized(req) {
+		if r.TokenAuth {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="ocitest"`, r.URL))
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ocitest"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.HasSuffix(p, "/tags/list"):
+		r.serveTags(w, req, strings.TrimSuffix(p, "/tags/list"))
+	case strings.Contains(p, "/manifests/"):
+		i := strings.LastIndex(p, "/manifests/")
+		r.serveManifest(w, req, p[:i], p[i+len("/manifests/"):])
+	case strings.Contains(p, "/blobs/"):
+		r.serveBlob(w, p[strings.LastIndex(p, "/blobs/")+len("/blobs/"):])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	u, p, ok := req.BasicAuth()
+	if !ok || u != r.Username || p != r.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+func (r *Registry) serveTags(w http.ResponseWriter, req *http.Request, repository string) {
+	r.mu.Lock()
+	manifests, ok := r.manifests[repository]
+	var tags []string
+	for t := range manifests {
+		if !strings.HasPrefix(t, "sha256:") {
+			tags = append(tags, t)
+		}
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sort.Strings(tags)
+
+	last := req.URL.Query().Get("last")
+	if last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+
+	n := r.PageSize
+	if q := req.URL.Query().Get("n"); q != "" {
+		n, _ = strconv.Atoi(q)
+	}
+	if n > 0 && len(tags) > n {
+		tags = tags[:n]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, repository, n, url.QueryEscape(tags[n-1])))
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	r.mu.Lock()
+	manifest, ok := r.manifests[repository][reference]
+	r.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", ManifestMediaType)
+	w.Header().Set("Docker-Content-Digest", Digest(manifest))
+	w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(manifest)
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, digest string) {
+	r.mu.Lock()
+	blob, ok := r.blobs[digest]
+	r.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(blob)
+}